@@ -79,16 +79,11 @@ func (a *Agent) Run(ctx context.Context, query string) (string, error) {
 			break
 		}
 
-		for _, toolCall := range message.ToolCalls {
-			toolResult, err := a.execute(ctx, toolCall.Function.Name, toolCall.Function.Arguments)
-			if err != nil {
-				toolResult = err.Error()
-			}
-			log.Printf("tool call %s, arguments %s, error: %v", toolCall.Function.Name, toolCall.Function.Arguments, err)
-			// 返回 tool message 到整体消息链中
-			a.messages = append(a.messages, openai.ToolMessage(toolResult, toolCall.ID))
+		// 返回 tool message 到整体消息链中，顺序与 tool calls 一致
+		results := a.executeToolCalls(ctx, message.ToolCalls)
+		for i, toolCall := range message.ToolCalls {
+			a.messages = append(a.messages, openai.ToolMessage(results[i], toolCall.ID))
 		}
-
 	}
 	return result, nil
 }
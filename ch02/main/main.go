@@ -22,11 +22,15 @@ func main() {
 	defer cancel()
 
 	modelConf := shared.NewModelConfig()
+	paths, err := shared.NewPathPolicy("", nil, nil)
+	if err != nil {
+		log.Fatalf("failed to create path policy: %v", err)
+	}
 
 	agent := ch02.NewAgent(modelConf, ch02.CodingAgentSystemPrompt, []tool.Tool{
-		tool.NewReadTool(),
-		tool.NewEditTool(),
-		tool.NewWriteTool(),
+		tool.NewReadTool(paths),
+		tool.NewEditTool(paths),
+		tool.NewWriteTool(paths),
 		tool.NewBashTool(),
 	})
 	result, err := agent.Run(ctx, *query)
@@ -0,0 +1,68 @@
+package tool
+
+import (
+	"strings"
+	"testing"
+)
+
+// 期望的 hunk 与 GNU diff -u 的输出一致
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		after  string
+		want   string
+	}{
+		{"no change", "a\nb\n", "a\nb\n", ""},
+		{"change in the middle", "1\n2\n3\n4\n5\n6\n7\n8\n9\n", "1\n2\n3\n4\nX\n6\n7\n8\n9\n",
+			"@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+X\n 6\n 7\n 8\n"},
+		{"insert at start", "a\nb\n", "new\na\nb\n",
+			"@@ -1,2 +1,3 @@\n+new\n a\n b\n"},
+		{"delete at end", "a\nb\nc\n", "a\nb\n",
+			"@@ -1,3 +1,2 @@\n a\n b\n-c\n"},
+		{"empty to content", "", "x\ny\n",
+			"@@ -0,0 +1,2 @@\n+x\n+y\n"},
+		{"content to empty", "x\ny\n", "",
+			"@@ -1,2 +0,0 @@\n-x\n-y\n"},
+		{"single line", "a\n", "b\n",
+			"@@ -1 +1 @@\n-a\n+b\n"},
+		{"no newline at end", "a\nb", "a\nc",
+			"@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n"},
+		{"two separate hunks", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n", "X\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\nY\n",
+			"@@ -1,4 +1,4 @@\n-1\n+X\n 2\n 3\n 4\n@@ -12,4 +12,4 @@\n 12\n 13\n 14\n-15\n+Y\n"},
+		{"close changes merged into one hunk", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n", "1\nA\n3\n4\n5\n6\n7\nB\n9\n10\n",
+			"@@ -1,10 +1,10 @@\n 1\n-2\n+A\n 3\n 4\n 5\n 6\n 7\n-8\n+B\n 9\n 10\n"},
+		{"longest common subsequence", "a\nb\nc\nd\n", "b\nx\nd\ny\n",
+			"@@ -1,4 +1,4 @@\n-a\n b\n-c\n+x\n d\n+y\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.want
+			if want != "" {
+				want = "--- f.txt\n+++ f.txt\n" + want
+			}
+			if got := unifiedDiff("f.txt", tt.before, tt.after); got != want {
+				t.Errorf("unifiedDiff() =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestLCSDiffFallback(t *testing.T) {
+	// 超过 DP 表上限时中间部分整体视为删除加新增
+	a := strings.Split(strings.Repeat("a\n", 2001), "\n")
+	b := strings.Split(strings.Repeat("b\n", 2001), "\n")
+	ops := lcsDiff(a, b)
+	if len(ops) != len(a)+len(b) {
+		t.Fatalf("got %d ops, want %d", len(ops), len(a)+len(b))
+	}
+	for i, op := range ops {
+		want := byte('-')
+		if i >= len(a) {
+			want = '+'
+		}
+		if op.kind != want {
+			t.Fatalf("op %d is %q, want %q", i, op.kind, want)
+		}
+	}
+}
@@ -3,24 +3,32 @@ package tool
 import (
 	"context"
 	"encoding/json"
-	"io"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/openai/openai-go/v3"
-	"github.com/openai/openai-go/v3/shared"
+	shared2 "github.com/openai/openai-go/v3/shared"
+
+	"babyagent/shared"
 )
 
-type EditTool struct{}
+type EditTool struct {
+	paths *shared.PathPolicy
+}
 
-func NewEditTool() *EditTool {
-	return &EditTool{}
+// NewEditTool 只能修改 paths 允许修改的路径，paths 为 nil 时不做限制
+func NewEditTool(paths *shared.PathPolicy) *EditTool {
+	return &EditTool{paths: paths}
 }
 
 type EditToolParam struct {
-	Path   string `json:"path"`
-	Before string `json:"before"`
-	After  string `json:"after"`
+	Path       string `json:"path"`
+	Before     string `json:"before"`
+	After      string `json:"after"`
+	ReplaceAll bool   `json:"replace_all"`
 }
 
 func (t *EditTool) ToolName() AgentTool {
@@ -28,9 +36,9 @@ func (t *EditTool) ToolName() AgentTool {
 }
 
 func (t *EditTool) Info() openai.ChatCompletionToolUnionParam {
-	return openai.ChatCompletionFunctionTool(shared.FunctionDefinitionParam{
+	return openai.ChatCompletionFunctionTool(shared2.FunctionDefinitionParam{
 		Name:        string(AgentToolEdit),
-		Description: openai.String("edit content in file"),
+		Description: openai.String("edit content in file by replacing before with after, before must match exactly once unless replace_all is set, returns a unified diff of the change"),
 		Parameters: openai.FunctionParameters{
 			"type": "object",
 			"properties": map[string]any{
@@ -46,6 +54,10 @@ func (t *EditTool) Info() openai.ChatCompletionToolUnionParam {
 					"type":        "string",
 					"description": "the content to replace with",
 				},
+				"replace_all": map[string]any{
+					"type":        "boolean",
+					"description": "replace every occurrence of before instead of requiring a unique match, defaults to false",
+				},
 			},
 			"required": []string{"path", "before", "after"},
 		},
@@ -58,22 +70,64 @@ func (t *EditTool) Execute(ctx context.Context, argumentsInJSON string) (string,
 	if err != nil {
 		return "", err
 	}
+	if p.Before == "" {
+		return "", errors.New("before must not be empty")
+	}
 
-	file, err := os.OpenFile(p.Path, os.O_RDWR, 0644)
+	path, err := t.paths.Resolve(p.Path, shared.PathWrite)
 	if err != nil {
 		return "", err
 	}
-	defer file.Close()
-
-	raw, err := io.ReadAll(file)
+	raw, err := os.ReadFile(path)
 	if err != nil {
 		return "", err
 	}
+	content := string(raw)
 
-	replaced := strings.ReplaceAll(string(raw), p.Before, p.After)
-	_, err = io.WriteString(file, replaced)
-	if err != nil {
+	count := strings.Count(content, p.Before)
+	switch {
+	case count == 0:
+		return "", fmt.Errorf("before not found in %s", p.Path)
+	case count > 1 && !p.ReplaceAll:
+		return "", fmt.Errorf("before matches %d times in %s, add more surrounding context to make it unique or set replace_all", count, p.Path)
+	}
+
+	replaced := strings.ReplaceAll(content, p.Before, p.After)
+	if err := writeFileAtomic(path, []byte(replaced)); err != nil {
 		return "", err
 	}
-	return "", nil
+
+	diff := unifiedDiff(p.Path, content, replaced)
+	if diff == "" {
+		return fmt.Sprintf("replaced %d occurrence(s) in %s, content unchanged", count, p.Path), nil
+	}
+	return fmt.Sprintf("replaced %d occurrence(s) in %s\n%s", count, p.Path, diff), nil
+}
+
+// writeFileAtomic 先写入同目录下的临时文件再 rename，保留原文件的权限，写入失败时原文件不受影响
+func writeFileAtomic(path string, data []byte) error {
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
 }
@@ -0,0 +1,125 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEditTool(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		param   EditToolParam
+		want    string // 编辑后的文件内容
+		output  string // 输出中应包含的片段
+		wantErr string
+	}{
+		{
+			name:    "unique match",
+			content: "a\nb\nc\n",
+			param:   EditToolParam{Before: "b", After: "B"},
+			want:    "a\nB\nc\n",
+			output:  "replaced 1 occurrence(s) in f.txt\n--- f.txt\n+++ f.txt\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name:    "replace_all",
+			content: "x = 1\ny = x\nz = x\n",
+			param:   EditToolParam{Before: "x", After: "w", ReplaceAll: true},
+			want:    "w = 1\ny = w\nz = w\n",
+			output:  "replaced 3 occurrence(s) in f.txt",
+		},
+		{
+			name:    "replace_all with a single match",
+			content: "a\nb\n",
+			param:   EditToolParam{Before: "a", After: "A", ReplaceAll: true},
+			want:    "A\nb\n",
+			output:  "replaced 1 occurrence(s) in f.txt",
+		},
+		{
+			name:    "after equals before",
+			content: "a\nb\n",
+			param:   EditToolParam{Before: "a", After: "a"},
+			want:    "a\nb\n",
+			output:  "replaced 1 occurrence(s) in f.txt, content unchanged",
+		},
+		{
+			name:    "before not found",
+			content: "a\nb\n",
+			param:   EditToolParam{Before: "c", After: "C"},
+			want:    "a\nb\n",
+			wantErr: "before not found in f.txt",
+		},
+		{
+			name:    "multiple matches without replace_all",
+			content: "x\nx\ny\n",
+			param:   EditToolParam{Before: "x", After: "z"},
+			want:    "x\nx\ny\n",
+			wantErr: "before matches 2 times in f.txt",
+		},
+		{
+			name:    "empty before",
+			content: "a\n",
+			param:   EditToolParam{Before: "", After: "b"},
+			want:    "a\n",
+			wantErr: "before must not be empty",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "f.txt")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			tt.param.Path = path
+			args, _ := json.Marshal(tt.param)
+			output, err := NewEditTool(nil).Execute(context.Background(), string(args))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(strings.ReplaceAll(err.Error(), path, "f.txt"), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := strings.ReplaceAll(output, path, "f.txt"); !strings.Contains(got, tt.output) {
+					t.Errorf("output does not contain %q:\n%s", tt.output, got)
+				}
+			}
+
+			// 出错时文件保持不变，成功时保留原文件的权限，且不留下临时文件
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tt.want {
+				t.Errorf("file content = %q, want %q", content, tt.want)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0600 {
+				t.Errorf("file mode = %v, want 0600", info.Mode().Perm())
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+				t.Errorf("%d entries in the directory, want only f.txt", len(entries))
+			}
+		})
+	}
+}
+
+func TestEditToolMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.txt")
+	args, _ := json.Marshal(EditToolParam{Path: path, Before: "a", After: "b"})
+	if _, err := NewEditTool(nil).Execute(context.Background(), string(args)); err == nil {
+		t.Fatal("want an error")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the missing file was created: %v", err)
+	}
+}
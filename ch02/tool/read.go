@@ -1,34 +1,61 @@
 package tool
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/openai/openai-go/v3"
-	"github.com/openai/openai-go/v3/shared"
+	shared2 "github.com/openai/openai-go/v3/shared"
+
+	"babyagent/shared"
+)
+
+const (
+	// defaultReadLimit 未指定 limit 时最多返回的行数
+	defaultReadLimit = 2000
+	// maxReadBytes 单次返回内容的字节上限，超出时提示模型用 offset 继续读取
+	maxReadBytes = 50 * 1024
+	// maxReadLineBytes 单行的字节上限，超出部分截断
+	maxReadLineBytes = 2000
+	// binarySniffBytes 检测二进制文件时读取的字节数
+	binarySniffBytes = 8000
 )
 
-type ReadTool struct{}
+type ReadTool struct {
+	paths *shared.PathPolicy
+}
 
-func NewReadTool() *ReadTool {
-	return &ReadTool{}
+// NewReadTool 只能读取 paths 允许的路径，paths 为 nil 时不做限制
+func NewReadTool(paths *shared.PathPolicy) *ReadTool {
+	return &ReadTool{paths: paths}
 }
 
 type ReadToolParam struct {
-	Path string `json:"path"`
+	Path   string `json:"path"`
+	Offset int    `json:"offset"`
+	Limit  int    `json:"limit"`
 }
 
 func (t *ReadTool) ToolName() AgentTool {
 	return AgentToolRead
 }
 
+func (t *ReadTool) ConcurrencySafe() bool {
+	return true
+}
+
 func (t *ReadTool) Info() openai.ChatCompletionToolUnionParam {
-	return openai.ChatCompletionFunctionTool(shared.FunctionDefinitionParam{
+	return openai.ChatCompletionFunctionTool(shared2.FunctionDefinitionParam{
 		Name:        string(AgentToolRead),
-		Description: openai.String("read file content"),
+		Description: openai.String("read file content. Each output line is prefixed with its line number and a tab, which is not part of the file content. Large files are returned in pages, use offset and limit to read the rest"),
 		Parameters: openai.FunctionParameters{
 			"type": "object",
 			"properties": map[string]any{
@@ -36,6 +63,14 @@ func (t *ReadTool) Info() openai.ChatCompletionToolUnionParam {
 					"type":        "string",
 					"description": "the file path to read",
 				},
+				"offset": map[string]any{
+					"type":        "integer",
+					"description": "the 1-based line number to start reading from, defaults to 1",
+				},
+				"limit": map[string]any{
+					"type":        "integer",
+					"description": fmt.Sprintf("the maximum number of lines to read, defaults to %d", defaultReadLimit),
+				},
 			},
 			"required": []string{"path"},
 		},
@@ -49,7 +84,11 @@ func (t *ReadTool) Execute(ctx context.Context, argumentsInJSON string) (string,
 		return "", err
 	}
 
-	file, err := os.Open(p.Path)
+	path, err := t.paths.Resolve(p.Path, shared.PathRead)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(path)
 	if err != nil {
 		return "", err
 	}
@@ -63,10 +102,102 @@ func (t *ReadTool) Execute(ctx context.Context, argumentsInJSON string) (string,
 		return "", fmt.Errorf("path is a directory")
 	}
 
-	content, err := io.ReadAll(file)
-	if err != nil {
-		return "", err
+	if p.Offset <= 0 {
+		p.Offset = 1
+	}
+	if p.Limit <= 0 {
+		p.Limit = defaultReadLimit
 	}
 
-	return string(content), nil
+	reader := bufio.NewReader(file)
+	sniff, _ := reader.Peek(binarySniffBytes)
+	if bytes.IndexByte(sniff, 0) >= 0 {
+		return "", fmt.Errorf("%s is a binary file (%d bytes), it can not be read as text", p.Path, fileInfo.Size())
+	}
+
+	var body strings.Builder
+	total, first, last := 0, 0, 0
+	crlf, lf := 0, 0
+	validUTF8, capped := true, false
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			total++
+			switch {
+			case bytes.HasSuffix(line, []byte("\r\n")):
+				crlf++
+			case bytes.HasSuffix(line, []byte("\n")):
+				lf++
+			}
+			if validUTF8 && !utf8.Valid(line) {
+				validUTF8 = false
+			}
+			if total >= p.Offset && total < p.Offset+p.Limit && !capped {
+				formatted := formatReadLine(total, line)
+				if body.Len()+len(formatted) > maxReadBytes && first != 0 {
+					capped = true
+				} else {
+					body.WriteString(formatted)
+					if first == 0 {
+						first = total
+					}
+					last = total
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if total == 0 {
+		return fmt.Sprintf("%s is empty", p.Path), nil
+	}
+	if first == 0 {
+		return "", fmt.Errorf("offset %d is beyond the end of %s (%d lines)", p.Offset, p.Path, total)
+	}
+
+	encoding := "UTF-8"
+	if !validUTF8 {
+		encoding = "not valid UTF-8, invalid bytes are shown as U+FFFD"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s: %d lines, %d bytes, line endings: %s, encoding: %s]\n",
+		p.Path, total, fileInfo.Size(), lineEndings(crlf, lf), encoding)
+	b.WriteString(body.String())
+	if last < total {
+		fmt.Fprintf(&b, "[showing lines %d-%d of %d, read again with offset=%d to continue]\n", first, last, total, last+1)
+	}
+	return b.String(), nil
+}
+
+// formatReadLine 输出带行号的一行，去掉行尾换行符，过长的行会被截断
+func formatReadLine(number int, line []byte) string {
+	line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+	text := strings.ToValidUTF8(string(line), "\uFFFD")
+	if len(text) > maxReadLineBytes {
+		cut := maxReadLineBytes
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		text = fmt.Sprintf("%s... [line truncated, %d bytes in total]", text[:cut], len(line))
+	}
+	return fmt.Sprintf("%6d\t%s\n", number, text)
+}
+
+// lineEndings 描述文件使用的换行符，修改文件时应保持一致
+func lineEndings(crlf int, lf int) string {
+	switch {
+	case crlf > 0 && lf > 0:
+		return fmt.Sprintf("mixed (%d CRLF, %d LF)", crlf, lf)
+	case crlf > 0:
+		return "CRLF"
+	case lf > 0:
+		return "LF"
+	default:
+		return "none (single line without trailing newline)"
+	}
 }
@@ -0,0 +1,134 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readFile(t *testing.T, content string, offset int, limit int) (string, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "f.txt")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	args, _ := json.Marshal(ReadToolParam{Path: path, Offset: offset, Limit: limit})
+	output, err := NewReadTool(nil).Execute(context.Background(), string(args))
+	// 输出中的临时路径替换为固定的名字，便于比较
+	if err != nil {
+		return "", errors.New(strings.ReplaceAll(err.Error(), path, "f.txt"))
+	}
+	return strings.ReplaceAll(output, path, "f.txt"), nil
+}
+
+func TestReadTool(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		offset  int
+		limit   int
+		want    []string // 输出中应包含的片段
+		wantErr string
+	}{
+		{
+			name:    "line numbers and LF",
+			content: "a\nb\n",
+			want:    []string{"[f.txt: 2 lines, 4 bytes, line endings: LF, encoding: UTF-8]\n", "     1\ta\n     2\tb\n"},
+		},
+		{
+			name:    "CRLF is reported and stripped from lines",
+			content: "a\r\nb\r\n",
+			want:    []string{"line endings: CRLF", "     1\ta\n     2\tb\n"},
+		},
+		{
+			name:    "mixed line endings",
+			content: "a\r\nb\nc",
+			want:    []string{"line endings: mixed (1 CRLF, 1 LF)", "     3\tc\n"},
+		},
+		{
+			name:    "single line without newline",
+			content: "only",
+			want:    []string{"line endings: none (single line without trailing newline)"},
+		},
+		{
+			name:    "UTF-8 content",
+			content: "你好，世界\n",
+			want:    []string{"encoding: UTF-8", "     1\t你好，世界\n"},
+		},
+		{
+			name:    "invalid UTF-8 is replaced",
+			content: "ok\n\xff\xfe bad\n",
+			want:    []string{"encoding: not valid UTF-8", "     2\t\uFFFD bad\n"},
+		},
+		{
+			name:    "binary file is rejected",
+			content: "PNG\x00\x01\x02",
+			wantErr: "f.txt is a binary file (6 bytes)",
+		},
+		{
+			name:    "empty file",
+			content: "",
+			want:    []string{"f.txt is empty"},
+		},
+		{
+			name:    "offset and limit",
+			content: "1\n2\n3\n4\n5\n",
+			offset:  2,
+			limit:   2,
+			want:    []string{"     2\t2\n     3\t3\n", "[showing lines 2-3 of 5, read again with offset=4 to continue]"},
+		},
+		{
+			name:    "offset beyond the end",
+			content: "1\n2\n",
+			offset:  5,
+			wantErr: "offset 5 is beyond the end of f.txt (2 lines)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readFile(t, tt.content, tt.offset, tt.limit)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("output does not contain %q:\n%s", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestReadToolCapsLongOutput(t *testing.T) {
+	line := strings.Repeat("x", 1000) + "\n"
+	got, err := readFile(t, strings.Repeat(line, 200), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) > maxReadBytes+1024 {
+		t.Errorf("output is %d bytes, want at most about %d", len(got), maxReadBytes)
+	}
+	if !strings.Contains(got, "of 200, read again with offset=") {
+		t.Errorf("output does not tell how to continue:\n%s", got[len(got)-200:])
+	}
+}
+
+func TestReadToolTruncatesLongLines(t *testing.T) {
+	got, err := readFile(t, strings.Repeat("界", maxReadLineBytes)+"\n", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "... [line truncated, 6000 bytes in total]") {
+		t.Errorf("long line is not truncated:\n%s", got[len(got)-200:])
+	}
+}
@@ -20,3 +20,9 @@ type Tool interface {
 	Info() openai.ChatCompletionToolUnionParam
 	Execute(ctx context.Context, argumentsInJSON string) (string, error)
 }
+
+// ConcurrencySafe 只读或者内部已经做好同步的工具实现该接口并返回 true，
+// 同一条 assistant 消息中的多个这类调用会并发执行，其余工具按顺序逐个执行
+type ConcurrencySafe interface {
+	ConcurrencySafe() bool
+}
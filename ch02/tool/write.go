@@ -6,13 +6,18 @@ import (
 	"os"
 
 	"github.com/openai/openai-go/v3"
-	"github.com/openai/openai-go/v3/shared"
+	shared2 "github.com/openai/openai-go/v3/shared"
+
+	"babyagent/shared"
 )
 
-type WriteTool struct{}
+type WriteTool struct {
+	paths *shared.PathPolicy
+}
 
-func NewWriteTool() *WriteTool {
-	return &WriteTool{}
+// NewWriteTool 只能写入 paths 允许修改的路径，paths 为 nil 时不做限制
+func NewWriteTool(paths *shared.PathPolicy) *WriteTool {
+	return &WriteTool{paths: paths}
 }
 
 type WriteToolParam struct {
@@ -25,7 +30,7 @@ func (t *WriteTool) ToolName() AgentTool {
 }
 
 func (t *WriteTool) Info() openai.ChatCompletionToolUnionParam {
-	return openai.ChatCompletionFunctionTool(shared.FunctionDefinitionParam{
+	return openai.ChatCompletionFunctionTool(shared2.FunctionDefinitionParam{
 		Name:        string(AgentToolWrite),
 		Description: openai.String("write content to file"),
 		Parameters: openai.FunctionParameters{
@@ -52,7 +57,11 @@ func (t *WriteTool) Execute(ctx context.Context, argumentsInJSON string) (string
 		return "", err
 	}
 
-	file, err := os.OpenFile(p.Path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	path, err := t.paths.Resolve(p.Path, shared.PathWrite)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return "", err
 	}
@@ -129,31 +129,11 @@ func (a *Agent) RunStreaming(ctx context.Context, query string, viewCh chan Mess
 			break
 		}
 
-		for _, toolCall := range message.ToolCalls {
-
-			viewCh <- MessageVO{
-				Type: MessageTypeToolCall,
-				ToolCall: &ToolCallVO{
-					Name:      toolCall.Function.Name,
-					Arguments: toolCall.Function.Arguments,
-				},
-			}
-
-			toolResult, err := a.execute(ctx, toolCall.Function.Name, toolCall.Function.Arguments)
-			if err != nil {
-				toolResult = err.Error()
-
-				viewCh <- MessageVO{
-					Type:    MessageTypeError,
-					Content: &toolResult,
-				}
-
-			}
-			log.Printf("tool call %s, arguments %s, error: %v", toolCall.Function.Name, toolCall.Function.Arguments, err)
-			// 返回 tool message 到整体消息链中
-			a.messages = append(a.messages, openai.ToolMessage(toolResult, toolCall.ID))
+		// 返回 tool message 到整体消息链中，顺序与 tool calls 一致
+		results := a.executeToolCalls(ctx, message.ToolCalls, viewCh)
+		for i, toolCall := range message.ToolCalls {
+			a.messages = append(a.messages, openai.ToolMessage(results[i], toolCall.ID))
 		}
-
 	}
 	return nil
 }
@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"charm.land/bubbles/v2/viewport"
 	tea "charm.land/bubbletea/v2"
@@ -230,6 +231,15 @@ func (m *model) handleStreamEvent(event ch03.MessageVO) {
 			m.appendLogBlock("工具调用:", fmt.Sprintf("%s(%s)", event.ToolCall.Name, event.ToolCall.Arguments))
 			m.resetOutputSection()
 		}
+	case ch03.MessageTypeToolDone:
+		if event.ToolCall != nil {
+			status := "完成"
+			if event.ToolCall.IsError {
+				status = "失败"
+			}
+			m.logs = append(m.logs, fmt.Sprintf("工具%s: %s（%s）", status, event.ToolCall.Name, event.ToolCall.Duration.Round(time.Millisecond)), "")
+			m.resetOutputSection()
+		}
 	case ch03.MessageTypeError:
 		if event.Content != nil {
 			m.appendLogBlock("错误:", *event.Content)
@@ -452,9 +462,9 @@ func (m *model) renderLogLine(line string) string {
 		return contentStyle.Render(line)
 	case strings.HasPrefix(line, "推理:"):
 		return reasonStyle.Render(line)
-	case strings.HasPrefix(line, "工具调用:"):
+	case strings.HasPrefix(line, "工具调用:"), strings.HasPrefix(line, "工具完成:"):
 		return toolStyle.Render(line)
-	case strings.HasPrefix(line, "错误:"):
+	case strings.HasPrefix(line, "错误:"), strings.HasPrefix(line, "工具失败:"):
 		return errorStyle.Render(line)
 	case strings.Trim(line, "─") == "":
 		return borderStyle.Render(line)
@@ -1,9 +1,12 @@
 package ch03
 
+import "time"
+
 const (
 	MessageTypeReasoning = "reasoning"
 	MessageTypeContent   = "content"
-	MessageTypeToolCall  = "tool_call"
+	MessageTypeToolCall  = "tool_call" // 工具调用开始
+	MessageTypeToolDone  = "tool_done" // 工具调用结束
 	MessageTypeError     = "error"
 )
 
@@ -18,6 +21,11 @@ type MessageVO struct {
 }
 
 type ToolCallVO struct {
+	ID        string `json:"id,omitempty"`
 	Name      string `json:"name"`
 	Arguments string `json:"arguments"`
+
+	// 以下字段只在 tool_done 中设置
+	Duration time.Duration `json:"duration,omitempty"`
+	IsError  bool          `json:"is_error,omitempty"`
 }
@@ -42,21 +42,26 @@ func NewAgent(modelConf shared.ModelConfig, systemPrompt string, tools []tool.To
 }
 
 func (a *Agent) execute(ctx context.Context, toolName string, argumentsInJSON string) (string, error) {
-	// 判断 native tool
-	t, ok := a.nativeTools[toolName]
-	if ok {
-		return t.Execute(ctx, argumentsInJSON)
+	t, ok := a.findTool(toolName)
+	if !ok {
+		return "", errors.New("tool not found")
+	}
+	return t.Execute(ctx, argumentsInJSON)
+}
+
+// findTool 先查找 native tool，再查找 MCP Tool
+func (a *Agent) findTool(toolName string) (tool.Tool, bool) {
+	if t, ok := a.nativeTools[toolName]; ok {
+		return t, true
 	}
-	// 判断 MCP Tool
 	for _, mcpClient := range a.mcpClients {
 		for _, t := range mcpClient.GetTools() {
-			if t.ToolName() != toolName {
-				continue
+			if t.ToolName() == toolName {
+				return t, true
 			}
-			return t.Execute(ctx, argumentsInJSON)
 		}
 	}
-	return "", errors.New("tool not found")
+	return nil, false
 }
 
 func (a *Agent) buildTools() []openai.ChatCompletionToolUnionParam {
@@ -151,31 +156,11 @@ func (a *Agent) RunStreaming(ctx context.Context, query string, viewCh chan Mess
 			break
 		}
 
-		for _, toolCall := range message.ToolCalls {
-
-			viewCh <- MessageVO{
-				Type: MessageTypeToolCall,
-				ToolCall: &ToolCallVO{
-					Name:      toolCall.Function.Name,
-					Arguments: toolCall.Function.Arguments,
-				},
-			}
-
-			toolResult, err := a.execute(ctx, toolCall.Function.Name, toolCall.Function.Arguments)
-			if err != nil {
-				toolResult = err.Error()
-
-				viewCh <- MessageVO{
-					Type:    MessageTypeError,
-					Content: &toolResult,
-				}
-
-			}
-			log.Printf("tool call %s, arguments %s, error: %v", toolCall.Function.Name, toolCall.Function.Arguments, err)
-			// 返回 tool message 到整体消息链中
-			a.messages = append(a.messages, openai.ToolMessage(toolResult, toolCall.ID))
+		// 返回 tool message 到整体消息链中，顺序与 tool calls 一致
+		results := a.executeToolCalls(ctx, message.ToolCalls, viewCh)
+		for i, toolCall := range message.ToolCalls {
+			a.messages = append(a.messages, openai.ToolMessage(results[i], toolCall.ID))
 		}
-
 	}
 	return nil
 }
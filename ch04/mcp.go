@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/openai/openai-go/v3"
@@ -22,6 +23,7 @@ type McpClient struct {
 	client       *mcp.Client
 	serverConfig shared.McpServerConfig
 
+	mu      sync.Mutex // 并发的工具调用共享同一个连接，建立连接时加锁
 	session *mcp.ClientSession
 	tools   []tool.Tool
 }
@@ -53,6 +55,8 @@ func (e *McpClient) Name() string {
 }
 
 func (e *McpClient) connect(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	// 服务联通，不需要再初始化
 	if e.session != nil && e.session.Ping(ctx, &mcp.PingParams{}) == nil {
 		return nil
@@ -106,7 +110,10 @@ func (e *McpClient) callTool(ctx context.Context, toolName string, argumentsInJS
 	if err := e.connect(ctx); err != nil {
 		return "", err
 	}
-	mcpResult, err := e.session.CallTool(ctx, &mcp.CallToolParams{
+	e.mu.Lock()
+	session := e.session
+	e.mu.Unlock()
+	mcpResult, err := session.CallTool(ctx, &mcp.CallToolParams{
 		Name:      toolName,
 		Arguments: json.RawMessage(argumentsInJSON),
 	})
@@ -145,6 +152,11 @@ func (t *McpTool) Info() openai.ChatCompletionToolUnionParam {
 	})
 }
 
+// ConcurrencySafe 服务端声明为只读的工具可以并发调用
+func (t *McpTool) ConcurrencySafe() bool {
+	return t.mcpTool.Annotations != nil && t.mcpTool.Annotations.ReadOnlyHint
+}
+
 func (t *McpTool) Execute(ctx context.Context, argumentsInJSON string) (string, error) {
 	return t.client.callTool(ctx, t.toolName, argumentsInJSON)
 }
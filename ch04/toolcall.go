@@ -0,0 +1,103 @@
+package ch04
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go/v3"
+
+	"babyagent/ch04/tool"
+)
+
+// maxParallelToolCalls 同一条消息中可以并发执行的工具调用数上限
+const maxParallelToolCalls = 4
+
+// executeToolCalls 执行一条 assistant 消息中的所有工具调用，返回的结果与 toolCalls 顺序一致。
+// 连续的并发安全调用分为一批，批内最多 maxParallelToolCalls 个同时执行；其他调用单独执行，
+// 它们之前和之后的调用不会与它重叠，保持原有的先后依赖
+func (a *Agent) executeToolCalls(ctx context.Context, toolCalls []openai.ChatCompletionMessageToolCallUnion, viewCh chan MessageVO) []string {
+	results := make([]string, len(toolCalls))
+	for start := 0; start < len(toolCalls); {
+		end := start + 1
+		if a.concurrencySafe(toolCalls[start].Function.Name) {
+			for end < len(toolCalls) && a.concurrencySafe(toolCalls[end].Function.Name) {
+				end++
+			}
+		}
+		a.executeBatch(ctx, toolCalls[start:end], results[start:end], viewCh)
+		start = end
+	}
+	return results
+}
+
+func (a *Agent) executeBatch(ctx context.Context, toolCalls []openai.ChatCompletionMessageToolCallUnion, results []string, viewCh chan MessageVO) {
+	workers := min(maxParallelToolCalls, len(toolCalls))
+	if workers == 1 {
+		for i, toolCall := range toolCalls {
+			results[i] = a.executeToolCall(ctx, toolCall, viewCh)
+		}
+		return
+	}
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, toolCall := range toolCalls {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = a.executeToolCall(ctx, toolCall, viewCh)
+		}()
+	}
+	wg.Wait()
+}
+
+// executeToolCall 执行单个工具调用并发送开始和结束事件，返回写入 tool message 的结果
+func (a *Agent) executeToolCall(ctx context.Context, toolCall openai.ChatCompletionMessageToolCallUnion, viewCh chan MessageVO) string {
+	viewCh <- MessageVO{
+		Type: MessageTypeToolCall,
+		ToolCall: &ToolCallVO{
+			ID:        toolCall.ID,
+			Name:      toolCall.Function.Name,
+			Arguments: toolCall.Function.Arguments,
+		},
+	}
+
+	started := time.Now()
+	toolResult, err := a.execute(ctx, toolCall.Function.Name, toolCall.Function.Arguments)
+	if err != nil {
+		toolResult = err.Error()
+
+		viewCh <- MessageVO{
+			Type:    MessageTypeError,
+			Content: &toolResult,
+		}
+
+	}
+	log.Printf("tool call %s, arguments %s, error: %v", toolCall.Function.Name, toolCall.Function.Arguments, err)
+
+	viewCh <- MessageVO{
+		Type: MessageTypeToolDone,
+		ToolCall: &ToolCallVO{
+			ID:        toolCall.ID,
+			Name:      toolCall.Function.Name,
+			Arguments: toolCall.Function.Arguments,
+			Duration:  time.Since(started),
+			IsError:   err != nil,
+		},
+	}
+	return toolResult
+}
+
+// concurrencySafe 工具是否声明可以与其他调用并发执行
+func (a *Agent) concurrencySafe(toolName string) bool {
+	t, ok := a.findTool(toolName)
+	if !ok {
+		return false
+	}
+	safe, ok := t.(tool.ConcurrencySafe)
+	return ok && safe.ConcurrencySafe()
+}
@@ -6,12 +6,14 @@ import (
 	"errors"
 	"log"
 	"os"
-	"runtime"
 	"strings"
+	"time"
 
 	"github.com/openai/openai-go/v3"
 	"github.com/openai/openai-go/v3/option"
 
+	"babyagent/ch05/memory"
+	"babyagent/ch05/tokenizer"
 	"babyagent/ch05/tool"
 	"babyagent/shared"
 )
@@ -20,15 +22,34 @@ type Agent struct {
 	systemPrompt string
 	model        string
 	client       openai.Client
-	messages     []openai.ChatCompletionMessageParamUnion
+	messages     []openai.ChatCompletionMessageParamUnion // 当前分支上的消息，即 tree 中从根节点到 head 的路径
+	messageTimes []time.Time                              // 与 messages 一一对应的创建时间
+	tree         *conversationTree
+	session      SessionInfo
 	nativeTools  map[tool.AgentTool]tool.Tool // agent 框架中原生实现的 tools
 	mcpClients   map[string]*McpClient        // 集成 mcp 工具
+	contextConf  ContextConfig
+	offloadStore *tool.OffloadStore   // 过大的工具结果卸载到磁盘
+	memoryStore  *memory.Store        // 跨会话的长期记忆
+	processes    *tool.ProcessManager // 会话中启动的后台进程
+	todos        *tool.TodoList       // 模型维护的任务列表
+	tokenizer    tokenizer.Tokenizer
+	usage        SessionUsage
+	// compactedTokens 上次压缩后历史消息的 token 数，切换会话或分支时清零
+	compactedTokens int
 }
 
-func NewAgent(modelConf shared.ModelConfig, systemPrompt string, tools []tool.Tool, mcpClients []*McpClient) *Agent {
+// NewAgent 创建 agent，paths 限制内置的后台进程工具可以使用的工作目录
+func NewAgent(modelConf shared.ModelConfig, contextConf ContextConfig, paths *shared.PathPolicy, systemPrompt string, tools []tool.Tool, mcpClients []*McpClient) (*Agent, error) {
 	a := Agent{
 		systemPrompt: systemPrompt,
 		model:        modelConf.Model,
+		contextConf:  contextConf,
+		tokenizer:    tokenizer.ForModel(modelConf.Model),
+		offloadStore: tool.NewOffloadStore(contextConf.OffloadDir),
+		memoryStore:  memory.NewStore(contextConf.UserMemoryPath, contextConf.ProjectMemoryPath),
+		processes:    tool.NewProcessManager(paths),
+		todos:        tool.NewTodoList(),
 		client:       openai.NewClient(option.WithBaseURL(modelConf.BaseURL), option.WithAPIKey(modelConf.ApiKey)),
 		nativeTools:  make(map[tool.AgentTool]tool.Tool),
 		mcpClients:   make(map[string]*McpClient),
@@ -37,43 +58,103 @@ func NewAgent(modelConf shared.ModelConfig, systemPrompt string, tools []tool.To
 	for _, t := range tools {
 		a.nativeTools[t.ToolName()] = t
 	}
+	if contextConf.OffloadThresholdBytes > 0 {
+		readOffloadTool := tool.NewReadOffloadTool(a.offloadStore)
+		a.nativeTools[readOffloadTool.ToolName()] = readOffloadTool
+	}
+	for _, t := range []tool.Tool{
+		tool.NewMemoryWriteTool(a.memoryStore),
+		tool.NewMemorySearchTool(a.memoryStore),
+		tool.NewMemoryDeleteTool(a.memoryStore),
+		tool.NewBackgroundStartTool(a.processes),
+		tool.NewBackgroundOutputTool(a.processes),
+		tool.NewBackgroundStatusTool(a.processes),
+		tool.NewBackgroundKillTool(a.processes),
+		tool.NewTodoWriteTool(a.todos),
+	} {
+		a.nativeTools[t.ToolName()] = t
+	}
 	for _, mcpClient := range mcpClients {
 		a.mcpClients[mcpClient.Name()] = mcpClient
 	}
-	a.messages = append(a.messages, openai.SystemMessage(a.buildSystemPrompt()))
-	return &a
+	prompt, err := a.buildSystemPrompt()
+	if err != nil {
+		return nil, err
+	}
+	a.startSession(prompt)
+	return &a, nil
 }
 
-func (a *Agent) buildSystemPrompt() string {
-	replaceMap := make(map[string]string)
-	replaceMap["{runtime}"] = runtime.GOOS
+// startSession 开始一个新的会话，只包含 system prompt
+func (a *Agent) startSession(prompt string) {
 	cwd, _ := os.Getwd()
-	replaceMap["{workspace_path}"] = cwd
+	now := time.Now()
+	a.session = SessionInfo{
+		ID:        newSessionID(),
+		Model:     a.model,
+		Workspace: cwd,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	a.tree = newConversationTree(openai.SystemMessage(prompt), now)
+	a.messages, a.messageTimes = a.tree.messages(a.tree.head)
+	a.usage = SessionUsage{}
+	a.compactedTokens = 0
+	a.todos.Set(nil)
+}
 
-	prompt := a.systemPrompt
-	for k, v := range replaceMap {
-		prompt = strings.ReplaceAll(prompt, k, v)
+// appendMessage 追加消息到当前分支，user 消息会在 head 之后开始新的一轮
+func (a *Agent) appendMessage(message openai.ChatCompletionMessageParamUnion) {
+	now := time.Now()
+	if message.OfUser != nil {
+		a.tree.head = a.tree.addTurn(a.tree.head, []openai.ChatCompletionMessageParamUnion{message}, []time.Time{now})
+	} else {
+		turn := a.tree.turns[a.tree.head]
+		turn.Messages = append(turn.Messages, message)
+		turn.Times = append(turn.Times, now)
 	}
+	a.messages = append(a.messages, message)
+	a.messageTimes = append(a.messageTimes, now)
+}
 
-	return prompt
+func (a *Agent) execute(ctx context.Context, toolName string, argumentsInJSON string) tool.ToolResult {
+	t, ok := a.findTool(toolName)
+	if !ok {
+		return tool.ErrorResult(errors.New("tool not found"))
+	}
+	// 调用前按工具声明的 schema 统一校验和修复参数，native tool 和 MCP tool 都适用
+	arguments, repairs, err := tool.ValidateArguments(toolParameters(t), argumentsInJSON)
+	if err != nil {
+		return tool.ErrorResult(err)
+	}
+	if len(repairs) > 0 {
+		log.Printf("repaired arguments of tool call %s: %s", toolName, strings.Join(repairs, "; "))
+	}
+	return tool.ExecuteResult(ctx, t, arguments)
+}
+
+// toolParameters 工具声明的参数 JSON Schema
+func toolParameters(t tool.Tool) map[string]any {
+	info := t.Info()
+	if info.OfFunction == nil {
+		return nil
+	}
+	return info.OfFunction.Function.Parameters
 }
 
-func (a *Agent) execute(ctx context.Context, toolName string, argumentsInJSON string) (string, error) {
-	// 判断 native tool
-	t, ok := a.nativeTools[toolName]
-	if ok {
-		return t.Execute(ctx, argumentsInJSON)
+// findTool 先查找 native tool，再查找 MCP Tool
+func (a *Agent) findTool(toolName string) (tool.Tool, bool) {
+	if t, ok := a.nativeTools[toolName]; ok {
+		return t, true
 	}
-	// 判断 MCP Tool
 	for _, mcpClient := range a.mcpClients {
 		for _, t := range mcpClient.GetTools() {
-			if t.ToolName() != toolName {
-				continue
+			if t.ToolName() == toolName {
+				return t, true
 			}
-			return t.Execute(ctx, argumentsInJSON)
 		}
 	}
-	return "", errors.New("tool not found")
+	return nil, false
 }
 
 func (a *Agent) buildTools() []openai.ChatCompletionToolUnionParam {
@@ -91,34 +172,49 @@ func (a *Agent) buildTools() []openai.ChatCompletionToolUnionParam {
 	return tools
 }
 
-func (a *Agent) ResetSession() {
-	a.messages = make([]openai.ChatCompletionMessageParamUnion, 0)
-	a.messages = append(a.messages, openai.SystemMessage(a.systemPrompt))
+func (a *Agent) ResetSession() error {
+	prompt, err := a.buildSystemPrompt()
+	if err != nil {
+		return err
+	}
+	if err := a.offloadStore.Clear(); err != nil {
+		log.Printf("failed to clear offloaded tool results: %v", err)
+	}
+	if err := a.closeToolResources(); err != nil {
+		log.Printf("failed to release tool resources: %v", err)
+	}
+	a.startSession(prompt)
+	return nil
 }
 
-func (a *Agent) SessionSnapshot() int {
-	return len(a.messages)
+// Close 释放 Agent 持有的会话资源
+func (a *Agent) Close() error {
+	return errors.Join(a.offloadStore.Clear(), a.closeToolResources())
 }
 
-func (a *Agent) RestoreSession(snapshot int) {
-	if snapshot < 1 {
-		snapshot = 1
-	}
-	if snapshot > len(a.messages) {
-		return
+// closeToolResources 释放工具持有的会话级资源，例如后台进程和 shell 进程
+func (a *Agent) closeToolResources() error {
+	errs := []error{a.processes.Close()}
+	for _, t := range a.nativeTools {
+		if closer, ok := t.(tool.SessionCloser); ok {
+			errs = append(errs, closer.Close())
+		}
 	}
-	a.messages = append([]openai.ChatCompletionMessageParamUnion{}, a.messages[:snapshot]...)
+	return errors.Join(errs...)
 }
 
 // RunStreaming 和 Run 基本逻辑一致，但是使用流式请求，并且通过 channel 实现流式输出
 func (a *Agent) RunStreaming(ctx context.Context, query string, viewCh chan MessageVO) error {
-	a.messages = append(a.messages, openai.UserMessage(query))
+	a.appendMessage(openai.UserMessage(query))
 
 	for {
 		params := openai.ChatCompletionNewParams{
 			Model:    a.model,
-			Messages: a.messages,
+			Messages: truncateMessages(a.tokenizer, a.messages, a.contextConf.MaxContextTokens),
 			Tools:    a.buildTools(),
+			StreamOptions: openai.ChatCompletionStreamOptionsParam{
+				IncludeUsage: openai.Bool(true),
+			},
 		}
 
 		log.Printf("calling llm model %s...", a.model)
@@ -154,6 +250,7 @@ func (a *Agent) RunStreaming(ctx context.Context, query string, viewCh chan Mess
 			}
 			return err
 		}
+		a.recordUsage(acc.Usage, true, viewCh)
 
 		if len(acc.Choices) == 0 {
 			log.Printf("no choices returned, resp: %v", acc)
@@ -161,42 +258,42 @@ func (a *Agent) RunStreaming(ctx context.Context, query string, viewCh chan Mess
 		}
 		message := acc.Choices[0].Message
 		// 拼接 assistant message 到整体消息链中
-		a.messages = append(a.messages, message.ToParam())
+		a.appendMessage(message.ToParam())
 
 		// tool loop 结束，可以返回结果
 		if len(message.ToolCalls) == 0 {
 			break
 		}
 
-		for _, toolCall := range message.ToolCalls {
-
-			viewCh <- MessageVO{
-				Type: MessageTypeToolCall,
-				ToolCall: &ToolCallVO{
-					Name:      toolCall.Function.Name,
-					Arguments: toolCall.Function.Arguments,
-				},
-			}
-
-			toolResult, err := a.execute(ctx, toolCall.Function.Name, toolCall.Function.Arguments)
-			if err != nil {
-				toolResult = err.Error()
-
-				viewCh <- MessageVO{
-					Type:    MessageTypeError,
-					Content: &toolResult,
-				}
-
-			}
-			log.Printf("tool call %s, arguments %s, error: %v", toolCall.Function.Name, toolCall.Function.Arguments, err)
-			// 返回 tool message 到整体消息链中
-			a.messages = append(a.messages, openai.ToolMessage(toolResult, toolCall.ID))
+		// 返回 tool message 到整体消息链中，顺序与 tool calls 一致
+		results := a.executeToolCalls(ctx, message.ToolCalls, viewCh)
+		for i, toolCall := range message.ToolCalls {
+			a.appendMessage(results[i].ToolMessage(toolCall.ID))
 		}
+	}
 
+	// 本轮结束后，历史消息过长时自动压缩
+	if a.shouldCompact() {
+		if err := a.compact(ctx, viewCh); err != nil && !errors.Is(err, ErrNothingToCompact) {
+			log.Printf("failed to compact context: %v", err)
+		}
+	}
+	if err := a.SaveSession(); err != nil {
+		log.Printf("failed to save session: %v", err)
 	}
 	return nil
 }
 
+// Todos 当前会话的任务列表
+func (a *Agent) Todos() []TodoVO {
+	items := a.todos.Items()
+	todos := make([]TodoVO, 0, len(items))
+	for _, item := range items {
+		todos = append(todos, TodoVO{Content: item.Content, Status: item.Status})
+	}
+	return todos
+}
+
 type deltaWithReasoning struct {
 	Content          string `json:"content"`
 	ReasoningContent string `json:"reasoning_content"`
@@ -0,0 +1,134 @@
+package ch05
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go/v3"
+
+	"babyagent/ch05/tool"
+)
+
+const (
+	// compactSummaryPrefix 标识由压缩生成的摘要消息
+	compactSummaryPrefix = "[Summary of the earlier conversation]\n"
+	// compactTodoHeader 摘要之后附带压缩时的任务列表，避免模型在压缩后丢失进度
+	compactTodoHeader = "\n\n[Current todo list, keep it up to date with the todo_write tool]\n"
+	// compactToolResultRunes 生成摘要时每条 tool 消息最多保留的字符数
+	compactToolResultRunes = 2000
+)
+
+var ErrNothingToCompact = errors.New("nothing to compact")
+
+// Compact 调用模型将较早的对话总结为一条摘要消息，并替换 Agent.messages 中对应的消息，
+// system prompt 和最近 CompactKeepTurns 轮对话保持不变
+func (a *Agent) Compact(ctx context.Context, viewCh chan MessageVO) error {
+	if err := a.compact(ctx, viewCh); err != nil {
+		return err
+	}
+	return a.SaveSession()
+}
+
+func (a *Agent) compact(ctx context.Context, viewCh chan MessageVO) error {
+	keepTurns := a.contextConf.CompactKeepTurns
+	if keepTurns < 1 {
+		keepTurns = 1
+	}
+	turns := splitTurns(a.messages, 1, len(a.messages))
+	if len(turns) <= keepTurns {
+		return ErrNothingToCompact
+	}
+	keepFrom := turns[len(turns)-keepTurns].start
+
+	params := openai.ChatCompletionNewParams{
+		Model: a.model,
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage(CompactSystemPrompt),
+			openai.UserMessage(renderTranscript(a.messages[1:keepFrom])),
+		},
+	}
+	log.Printf("compacting %d messages with llm model %s...", keepFrom-1, a.model)
+	resp, err := a.client.Chat.Completions.New(ctx, params)
+	if err != nil {
+		return err
+	}
+	a.recordUsage(resp.Usage, false, viewCh)
+	if len(resp.Choices) == 0 || resp.Choices[0].Message.Content == "" {
+		return errors.New("empty summary returned")
+	}
+	summary := resp.Choices[0].Message.Content
+	content := compactSummaryPrefix + summary
+	if todos := a.todos.Items(); len(todos) > 0 {
+		content += compactTodoHeader + tool.FormatTodos(todos)
+	}
+
+	before := estimateMessagesTokens(a.tokenizer, a.messages)
+	// 压缩后的历史作为根节点下的新分支：摘要 + 保留的轮次，原来的分支仍然可以切换回去
+	head := a.tree.addTurn(0,
+		[]openai.ChatCompletionMessageParamUnion{openai.UserMessage(content)},
+		[]time.Time{time.Now()})
+	for _, turn := range splitTurns(a.messages, keepFrom, len(a.messages)) {
+		head = a.tree.addTurn(head,
+			append([]openai.ChatCompletionMessageParamUnion{}, a.messages[turn.start:turn.end]...),
+			append([]time.Time{}, a.messageTimes[turn.start:turn.end]...))
+	}
+	a.tree.head = head
+	a.messages, a.messageTimes = a.tree.messages(head)
+	a.compactedTokens = estimateMessagesTokens(a.tokenizer, a.messages)
+	log.Printf("context compacted: %d -> %d tokens", before, a.compactedTokens)
+
+	viewCh <- MessageVO{
+		Type:    MessageTypeCompact,
+		Content: &summary,
+	}
+	return nil
+}
+
+// shouldCompact 判断当前历史消息是否超过自动压缩的阈值。
+// 上次压缩后仍超过阈值时，说明保留的轮次本身就很大，历史在压缩后再增长阈值的 1/4 之前不再压缩，避免每轮都调用模型
+func (a *Agent) shouldCompact() bool {
+	threshold := a.contextConf.CompactThresholdTokens
+	if threshold <= 0 {
+		return false
+	}
+	tokens := estimateMessagesTokens(a.tokenizer, a.messages)
+	if tokens <= threshold {
+		return false
+	}
+	return a.compactedTokens <= threshold || tokens >= a.compactedTokens+threshold/4
+}
+
+// renderTranscript 将消息渲染为纯文本对话记录，供模型生成摘要
+func renderTranscript(messages []openai.ChatCompletionMessageParamUnion) string {
+	var b strings.Builder
+	for _, message := range messages {
+		switch {
+		case message.OfUser != nil:
+			fmt.Fprintf(&b, "[user]\n%s\n\n", message.OfUser.Content.OfString.Value)
+		case message.OfAssistant != nil:
+			b.WriteString("[assistant]\n")
+			if content := message.OfAssistant.Content.OfString.Value; content != "" {
+				b.WriteString(content)
+				b.WriteString("\n")
+			}
+			for _, toolCall := range message.OfAssistant.ToolCalls {
+				if toolCall.OfFunction == nil {
+					continue
+				}
+				fmt.Fprintf(&b, "call %s(%s)\n", toolCall.OfFunction.Function.Name, toolCall.OfFunction.Function.Arguments)
+			}
+			b.WriteString("\n")
+		case message.OfTool != nil:
+			content := []rune(message.OfTool.Content.OfString.Value)
+			if len(content) > compactToolResultRunes {
+				content = append(content[:compactToolResultRunes], []rune(fmt.Sprintf("\n...[%d characters omitted]", len(content)-compactToolResultRunes))...)
+			}
+			fmt.Fprintf(&b, "[tool result]\n%s\n\n", string(content))
+		}
+	}
+	return b.String()
+}
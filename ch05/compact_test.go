@@ -0,0 +1,50 @@
+package ch05
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go/v3"
+
+	"babyagent/ch05/tokenizer"
+)
+
+func TestShouldCompact(t *testing.T) {
+	a := &Agent{
+		contextConf: ContextConfig{CompactThresholdTokens: 1000},
+		tokenizer:   tokenizer.Heuristic{},
+	}
+	setTokens := func(n int) {
+		a.messages = []openai.ChatCompletionMessageParamUnion{openai.UserMessage(strings.Repeat("word ", n))}
+	}
+	tokens := func() int { return estimateMessagesTokens(a.tokenizer, a.messages) }
+
+	setTokens(100)
+	if a.shouldCompact() {
+		t.Fatalf("compacted below the threshold (%d tokens)", tokens())
+	}
+	setTokens(2000)
+	if !a.shouldCompact() {
+		t.Fatalf("did not compact above the threshold (%d tokens)", tokens())
+	}
+
+	// 压缩后保留的轮次仍超过阈值，之后的小幅增长不再触发压缩
+	a.compactedTokens = tokens()
+	if a.shouldCompact() {
+		t.Fatal("compacted again right after a compaction that could not get under the threshold")
+	}
+	a.compactedTokens -= 200
+	if a.shouldCompact() {
+		t.Fatal("compacted again after growing less than a quarter of the threshold")
+	}
+	a.compactedTokens -= 100
+	if !a.shouldCompact() {
+		t.Fatal("did not compact after growing past a quarter of the threshold")
+	}
+
+	// 上次压缩回到阈值以下时按阈值正常判断
+	a.compactedTokens = 500
+	if !a.shouldCompact() {
+		t.Fatal("did not compact above the threshold after a successful compaction")
+	}
+}
@@ -0,0 +1,80 @@
+package ch05
+
+import (
+	"os"
+	"path/filepath"
+
+	"babyagent/ch05/memory"
+	"babyagent/ch05/tool"
+)
+
+const (
+	defaultMaxContextTokens       = 64000
+	defaultCompactThresholdTokens = 48000
+	defaultCompactKeepTurns       = 2
+	defaultOffloadThresholdBytes  = 16 * 1024
+	defaultOffloadPreviewBytes    = 2 * 1024
+	defaultPromptMemoryLimit      = 50
+	defaultMaxInstructionBytes    = 32 * 1024
+	defaultMaxParallelToolCalls   = 4
+)
+
+// ContextConfig 上下文工程相关的配置
+type ContextConfig struct {
+	// MaxContextTokens 每次请求模型时上下文的 token 预算，超出预算时会截断最早的对话轮次
+	MaxContextTokens int `json:"max_context_tokens"`
+	// CompactThresholdTokens 一轮对话结束后历史消息超过该 token 数时，自动调用模型进行摘要压缩，<= 0 表示关闭
+	CompactThresholdTokens int `json:"compact_threshold_tokens"`
+	// CompactKeepTurns 压缩时原样保留的最近对话轮数
+	CompactKeepTurns int `json:"compact_keep_turns"`
+	// ToolOutputPolicy 工具没有声明输出策略时使用的默认策略，超过卸载阈值的结果会先完整卸载，再按策略截断
+	ToolOutputPolicy tool.OutputPolicy `json:"tool_output_policy"`
+	// ToolOutputPolicies 按工具名覆盖输出策略，优先级高于工具自己声明的策略，可用于 MCP 工具
+	ToolOutputPolicies map[string]tool.OutputPolicy `json:"tool_output_policies"`
+	// OffloadThresholdBytes 工具结果超过该字节数时写入磁盘，只把预览和句柄返回给模型，<= 0 表示关闭
+	OffloadThresholdBytes int `json:"offload_threshold_bytes"`
+	// OffloadPreviewBytes 卸载时返回给模型的预览字节数
+	OffloadPreviewBytes int `json:"offload_preview_bytes"`
+	// OffloadDir 卸载内容存放的目录，为空时使用系统临时目录
+	OffloadDir string `json:"offload_dir"`
+	// UserMemoryPath 用户级长期记忆文件，为空表示不启用
+	UserMemoryPath string `json:"user_memory_path"`
+	// ProjectMemoryPath 项目级长期记忆文件，为空表示不启用
+	ProjectMemoryPath string `json:"project_memory_path"`
+	// PromptMemoryLimit 会话开始时注入 system prompt 的记忆条数上限
+	PromptMemoryLimit int `json:"prompt_memory_limit"`
+	// InstructionFileNames 项目指令文件名，在全局配置目录、仓库根目录到当前目录的每一级目录中查找
+	InstructionFileNames []string `json:"instruction_file_names"`
+	// GlobalInstructionDir 全局指令文件所在目录，为空表示不加载
+	GlobalInstructionDir string `json:"global_instruction_dir"`
+	// MaxInstructionBytes 注入 system prompt 的指令文件总字节数上限
+	MaxInstructionBytes int `json:"max_instruction_bytes"`
+	// SessionDir 会话保存目录，每轮对话结束后写入，为空表示不保存
+	SessionDir string `json:"session_dir"`
+	// MaxParallelToolCalls 同一条消息中可以并发执行的工具调用数上限，<= 1 表示全部按顺序执行
+	MaxParallelToolCalls int `json:"max_parallel_tool_calls"`
+}
+
+func NewContextConfig() ContextConfig {
+	cwd, _ := os.Getwd()
+	globalInstructionDir := ""
+	if dir, err := os.UserConfigDir(); err == nil {
+		globalInstructionDir = filepath.Join(dir, "babyagent")
+	}
+	return ContextConfig{
+		MaxContextTokens:       defaultMaxContextTokens,
+		CompactThresholdTokens: defaultCompactThresholdTokens,
+		CompactKeepTurns:       defaultCompactKeepTurns,
+		ToolOutputPolicy:       tool.DefaultOutputPolicy,
+		OffloadThresholdBytes:  defaultOffloadThresholdBytes,
+		OffloadPreviewBytes:    defaultOffloadPreviewBytes,
+		UserMemoryPath:         memory.DefaultUserPath(),
+		ProjectMemoryPath:      memory.DefaultProjectPath(cwd),
+		PromptMemoryLimit:      defaultPromptMemoryLimit,
+		InstructionFileNames:   []string{"AGENTS.md", "BABYAGENT.md"},
+		GlobalInstructionDir:   globalInstructionDir,
+		MaxInstructionBytes:    defaultMaxInstructionBytes,
+		SessionDir:             DefaultSessionDir(cwd),
+		MaxParallelToolCalls:   defaultMaxParallelToolCalls,
+	}
+}
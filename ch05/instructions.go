@@ -0,0 +1,110 @@
+package ch05
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// instructionFile 项目指令文件，例如 AGENTS.md，通常记录项目的构建、测试约定
+type instructionFile struct {
+	path      string
+	content   string
+	truncated bool
+}
+
+// loadInstructionFiles 按照 全局配置目录 -> 仓库根目录 -> ... -> 当前工作目录 的顺序加载指令文件，
+// 越靠后的文件越具体。所有文件的总大小不超过 MaxInstructionBytes，超出部分会被截断
+func loadInstructionFiles(conf ContextConfig, workspace string) []instructionFile {
+	dirs := make([]string, 0)
+	if conf.GlobalInstructionDir != "" {
+		dirs = append(dirs, conf.GlobalInstructionDir)
+	}
+	dirs = append(dirs, workspaceDirs(workspace)...)
+
+	files := make([]instructionFile, 0)
+	remaining := conf.MaxInstructionBytes
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		for _, name := range conf.InstructionFileNames {
+			if remaining <= 0 {
+				log.Printf("instruction files exceed %d bytes, skipping the rest", conf.MaxInstructionBytes)
+				return files
+			}
+			path := filepath.Join(dir, name)
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			file := instructionFile{path: path, content: string(raw)}
+			if len(file.content) > remaining {
+				file.content = strings.ToValidUTF8(file.content[:remaining], "")
+				file.truncated = true
+			}
+			remaining -= len(file.content)
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// workspaceDirs 返回从仓库根目录到 workspace 的所有目录，不在 git 仓库中时只返回 workspace
+func workspaceDirs(workspace string) []string {
+	root := findRepoRoot(workspace)
+	if root == "" {
+		return []string{workspace}
+	}
+
+	dirs := []string{workspace}
+	for dir := workspace; dir != root; {
+		dir = filepath.Dir(dir)
+		dirs = append(dirs, dir)
+	}
+	// 反转为从根目录到 workspace
+	for i, j := 0, len(dirs)-1; i < j; i, j = i+1, j-1 {
+		dirs[i], dirs[j] = dirs[j], dirs[i]
+	}
+	return dirs
+}
+
+// findRepoRoot 向上查找包含 .git 的目录
+func findRepoRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// renderInstructions 渲染为 system prompt 中的一节，先列出加载了哪些文件，再依次给出内容
+func renderInstructions(files []instructionFile) string {
+	if len(files) == 0 {
+		return "(no instruction files found)"
+	}
+
+	var b strings.Builder
+	b.WriteString("Loaded instruction files, later files are more specific and take precedence:\n")
+	for _, file := range files {
+		fmt.Fprintf(&b, "- %s", file.path)
+		if file.truncated {
+			b.WriteString(" (truncated)")
+		}
+		b.WriteString("\n")
+	}
+	for _, file := range files {
+		fmt.Fprintf(&b, "\n### %s\n%s\n", file.path, strings.TrimSpace(file.content))
+	}
+	return b.String()
+}
@@ -7,13 +7,13 @@ import (
 	"log"
 	"os"
 	"os/exec"
-	"strings"
+	"sync"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/openai/openai-go/v3"
 	shared2 "github.com/openai/openai-go/v3/shared"
 
-	"babyagent/ch04/tool"
+	"babyagent/ch05/tool"
 	"babyagent/shared"
 )
 
@@ -22,6 +22,7 @@ type McpClient struct {
 	client       *mcp.Client
 	serverConfig shared.McpServerConfig
 
+	mu      sync.Mutex // 并发的工具调用共享同一个连接，建立连接时加锁
 	session *mcp.ClientSession
 	tools   []tool.Tool
 }
@@ -52,6 +53,8 @@ func (e *McpClient) Name() string {
 }
 
 func (e *McpClient) connect(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	// 服务联通，不需要再初始化
 	if e.session != nil && e.session.Ping(ctx, &mcp.PingParams{}) == nil {
 		return nil
@@ -101,26 +104,23 @@ func (e *McpClient) GetTools() []tool.Tool {
 	return e.tools
 }
 
-func (e *McpClient) callTool(ctx context.Context, toolName string, argumentsInJSON string) (string, error) {
+// callTool 调用 MCP 工具，返回的内容、IsError 和 _meta 转换为 tool.ToolResult
+func (e *McpClient) callTool(ctx context.Context, toolName string, argumentsInJSON string) (tool.ToolResult, error) {
 	if err := e.connect(ctx); err != nil {
-		return "", err
+		return tool.ToolResult{}, err
 	}
-	mcpResult, err := e.session.CallTool(ctx, &mcp.CallToolParams{
+	e.mu.Lock()
+	session := e.session
+	e.mu.Unlock()
+	mcpResult, err := session.CallTool(ctx, &mcp.CallToolParams{
 		Name:      toolName,
 		Arguments: json.RawMessage(argumentsInJSON),
 	})
 	if err != nil {
 		log.Printf("failed to call tool: %v", err)
-		return "", err
-	}
-
-	var builder strings.Builder
-	for _, content := range mcpResult.Content {
-		if textContent, ok := content.(*mcp.TextContent); ok {
-			builder.WriteString(textContent.Text)
-		}
+		return tool.ToolResult{}, err
 	}
-	return builder.String(), nil
+	return tool.ResultFromMCP(mcpResult), nil
 }
 
 // McpTool 实现 tool.Tool 接口
@@ -144,6 +144,19 @@ func (t *McpTool) Info() openai.ChatCompletionToolUnionParam {
 	})
 }
 
+// ConcurrencySafe 服务端声明为只读的工具可以并发调用
+func (t *McpTool) ConcurrencySafe(string) bool {
+	return t.mcpTool.Annotations != nil && t.mcpTool.Annotations.ReadOnlyHint
+}
+
 func (t *McpTool) Execute(ctx context.Context, argumentsInJSON string) (string, error) {
+	result, err := t.client.callTool(ctx, t.toolName, argumentsInJSON)
+	if err != nil {
+		return "", err
+	}
+	return result.Output()
+}
+
+func (t *McpTool) ExecuteResult(ctx context.Context, argumentsInJSON string) (tool.ToolResult, error) {
 	return t.client.callTool(ctx, t.toolName, argumentsInJSON)
 }
@@ -0,0 +1,224 @@
+package memory
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Scope = string
+
+const (
+	ScopeProject Scope = "project" // 当前项目相关的记忆，例如构建、测试约定
+	ScopeUser    Scope = "user"    // 跨项目的用户偏好
+)
+
+// Memory 一条长期记忆
+type Memory struct {
+	ID        string    `json:"id"`
+	Scope     Scope     `json:"scope"`
+	Content   string    `json:"content"`
+	Tags      []string  `json:"tags,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Store 基于 JSON 文件的长期记忆存储，每个 scope 对应一个文件
+type Store struct {
+	mu    sync.Mutex
+	paths map[Scope]string
+}
+
+// NewStore 路径为空表示不启用对应 scope
+func NewStore(userPath, projectPath string) *Store {
+	paths := make(map[Scope]string)
+	if userPath != "" {
+		paths[ScopeUser] = userPath
+	}
+	if projectPath != "" {
+		paths[ScopeProject] = projectPath
+	}
+	return &Store{paths: paths}
+}
+
+// DefaultUserPath 用户级记忆默认存放在用户配置目录下
+func DefaultUserPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "babyagent", "memory.json")
+}
+
+// DefaultProjectPath 项目级记忆默认存放在项目的 .babyagent 目录下，可以随代码仓库共享
+func DefaultProjectPath(workspace string) string {
+	return filepath.Join(workspace, ".babyagent", "memory.json")
+}
+
+// Write 在 scope 中新增一条记忆。id 不为空时在所有 scope 中查找并更新已有的记忆，scope 被忽略，记忆保留在原来的 scope 中
+func (s *Store) Write(scope Scope, id string, content string, tags []string) (Memory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if strings.TrimSpace(content) == "" {
+		return Memory{}, errors.New("memory content is empty")
+	}
+	now := time.Now()
+	if id != "" {
+		for _, sc := range s.scopes() {
+			memories, err := s.load(sc)
+			if err != nil {
+				return Memory{}, err
+			}
+			for i := range memories {
+				if memories[i].ID != id {
+					continue
+				}
+				memories[i].Content = content
+				memories[i].Tags = tags
+				memories[i].UpdatedAt = now
+				return memories[i], s.save(sc, memories)
+			}
+		}
+		return Memory{}, fmt.Errorf("memory %q not found", id)
+	}
+
+	memories, err := s.load(scope)
+	if err != nil {
+		return Memory{}, err
+	}
+	memory := Memory{
+		ID:        newID(),
+		Scope:     scope,
+		Content:   content,
+		Tags:      tags,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	memories = append(memories, memory)
+	return memory, s.save(scope, memories)
+}
+
+// Delete 删除指定 id 的记忆
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, scope := range s.scopes() {
+		memories, err := s.load(scope)
+		if err != nil {
+			return err
+		}
+		for i := range memories {
+			if memories[i].ID == id {
+				return s.save(scope, append(memories[:i], memories[i+1:]...))
+			}
+		}
+	}
+	return fmt.Errorf("memory %q not found", id)
+}
+
+// Search 按关键词匹配记忆内容和标签，按命中数和更新时间排序；query 为空时返回最近更新的记忆；scope 为空时搜索全部
+func (s *Store) Search(query string, scope Scope, limit int) ([]Memory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all := make([]Memory, 0)
+	for _, sc := range s.scopes() {
+		if scope != "" && sc != scope {
+			continue
+		}
+		memories, err := s.load(sc)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, memories...)
+	}
+
+	terms := strings.Fields(strings.ToLower(query))
+	scores := make(map[string]int)
+	matched := make([]Memory, 0, len(all))
+	for _, memory := range all {
+		text := strings.ToLower(memory.Content + " " + strings.Join(memory.Tags, " "))
+		score := 0
+		for _, term := range terms {
+			if strings.Contains(text, term) {
+				score++
+			}
+		}
+		if len(terms) > 0 && score == 0 {
+			continue
+		}
+		scores[memory.ID] = score
+		matched = append(matched, memory)
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		if scores[matched[i].ID] != scores[matched[j].ID] {
+			return scores[matched[i].ID] > scores[matched[j].ID]
+		}
+		return matched[i].UpdatedAt.After(matched[j].UpdatedAt)
+	})
+	if limit > 0 && len(matched) > limit {
+		matched = matched[:limit]
+	}
+	return matched, nil
+}
+
+// scopes 已启用的 scope，按固定顺序返回
+func (s *Store) scopes() []Scope {
+	return slices.Sorted(maps.Keys(s.paths))
+}
+
+func (s *Store) load(scope Scope) ([]Memory, error) {
+	path, ok := s.paths[scope]
+	if !ok {
+		return nil, fmt.Errorf("memory scope %q is not enabled", scope)
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return make([]Memory, 0), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	memories := make([]Memory, 0)
+	if err := json.Unmarshal(content, &memories); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return memories, nil
+}
+
+// save 先写临时文件再 rename，避免写到一半时损坏记忆文件
+func (s *Store) save(scope Scope, memories []Memory) error {
+	path := s.paths[scope]
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(memories, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func newID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return "mem-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,155 @@
+package memory
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func newTestStore(t *testing.T) (*Store, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	userPath := filepath.Join(dir, "user", "memory.json")
+	projectPath := filepath.Join(dir, "project", ".babyagent", "memory.json")
+	return NewStore(userPath, projectPath), userPath, projectPath
+}
+
+// readMemories 直接读取记忆文件，检查持久化的内容
+func readMemories(t *testing.T, path string) []Memory {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	memories := make([]Memory, 0)
+	if err := json.Unmarshal(content, &memories); err != nil {
+		t.Fatal(err)
+	}
+	return memories
+}
+
+func contents(memories []Memory) []string {
+	result := make([]string, 0, len(memories))
+	for _, m := range memories {
+		result = append(result, m.Content)
+	}
+	return result
+}
+
+func TestStoreWriteUpdateDelete(t *testing.T) {
+	store, userPath, projectPath := newTestStore(t)
+
+	project, err := store.Write(ScopeProject, "", "run tests with go test ./...", []string{"test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := store.Write(ScopeUser, "", "prefers tabs", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project.ID == "" || project.ID == user.ID {
+		t.Fatalf("ids: %q and %q", project.ID, user.ID)
+	}
+	if got := contents(readMemories(t, projectPath)); !slices.Equal(got, []string{"run tests with go test ./..."}) {
+		t.Errorf("project file: %q", got)
+	}
+	if got := contents(readMemories(t, userPath)); !slices.Equal(got, []string{"prefers tabs"}) {
+		t.Errorf("user file: %q", got)
+	}
+
+	// 按 id 更新时在所有 scope 中查找，传入的 scope 被忽略
+	updated, err := store.Write(ScopeProject, user.ID, "prefers spaces", []string{"style"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.ID != user.ID || updated.Scope != ScopeUser || !updated.CreatedAt.Equal(user.CreatedAt) {
+		t.Errorf("updated memory: %+v", updated)
+	}
+	if got := readMemories(t, userPath); len(got) != 1 || got[0].Content != "prefers spaces" || !slices.Equal(got[0].Tags, []string{"style"}) {
+		t.Errorf("user file after update: %+v", got)
+	}
+	if got := readMemories(t, projectPath); len(got) != 1 {
+		t.Errorf("project file after updating a user memory: %+v", got)
+	}
+	if _, err := store.Write(ScopeProject, "missing", "x", nil); err == nil {
+		t.Error("updating a missing id: want an error")
+	}
+	if _, err := store.Write(ScopeProject, "", "  ", nil); err == nil {
+		t.Error("empty content: want an error")
+	}
+
+	if err := store.Delete(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := readMemories(t, userPath); len(got) != 0 {
+		t.Errorf("user file after delete: %+v", got)
+	}
+	if err := store.Delete(user.ID); err == nil {
+		t.Error("deleting twice: want an error")
+	}
+
+	// 新的 Store 从文件中读取之前写入的记忆
+	reopened := NewStore(userPath, projectPath)
+	all, err := reopened.Search("", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].ID != project.ID || all[0].Scope != ScopeProject {
+		t.Errorf("reopened store: %+v", all)
+	}
+}
+
+func TestStoreSearch(t *testing.T) {
+	store, _, _ := newTestStore(t)
+	for _, m := range []struct {
+		scope   Scope
+		content string
+		tags    []string
+	}{
+		{ScopeProject, "build with make", []string{"build"}},
+		{ScopeProject, "run go test before committing", []string{"test", "go"}},
+		{ScopeUser, "answer in Chinese", nil},
+		{ScopeUser, "likes short go test output", nil},
+	} {
+		if _, err := store.Write(m.scope, "", m.content, m.tags); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		scope Scope
+		limit int
+		want  []string
+	}{
+		{name: "more matching terms first", query: "go test committing", want: []string{"run go test before committing", "likes short go test output"}},
+		{name: "tags are searched", query: "BUILD", want: []string{"build with make"}},
+		{name: "scope filter", query: "go", scope: ScopeUser, want: []string{"likes short go test output"}},
+		{name: "empty query returns the most recent", limit: 2, want: []string{"likes short go test output", "answer in Chinese"}},
+		{name: "no match", query: "python", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.Search(tt.query, tt.scope, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(contents(got), tt.want) {
+				t.Errorf("got %q, want %q", contents(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestStoreDisabledScope(t *testing.T) {
+	store := NewStore("", filepath.Join(t.TempDir(), "memory.json"))
+	if _, err := store.Write(ScopeUser, "", "x", nil); err == nil {
+		t.Error("writing to a disabled scope: want an error")
+	}
+	if _, err := store.Write(ScopeProject, "", "x", nil); err != nil {
+		t.Fatal(err)
+	}
+}
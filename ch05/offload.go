@@ -0,0 +1,59 @@
+package ch05
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"babyagent/ch05/tool"
+)
+
+// offloadToolResult 工具结果过大时写入磁盘，只返回预览和句柄，模型可以通过 read_offload 工具按需读取。
+// 预览按工具的输出策略在开头和结尾之间分配，命令输出末尾的错误信息不会丢失
+func (a *Agent) offloadToolResult(toolName string, result tool.ToolResult) tool.ToolResult {
+	text := result.Text()
+	threshold := a.contextConf.OffloadThresholdBytes
+	if threshold <= 0 || len(text) <= threshold || toolName == tool.AgentToolReadOffload {
+		return result
+	}
+
+	handle, err := a.offloadStore.Save(text)
+	if err != nil {
+		log.Printf("failed to offload tool result: %v", err)
+		return result
+	}
+
+	previewPolicy := a.outputPolicy(toolName)
+	previewPolicy.MaxBytes = a.contextConf.OffloadPreviewBytes
+	preview := ""
+	if previewPolicy.MaxBytes > 0 {
+		preview = previewPolicy.Apply(text)
+		if !strings.HasSuffix(preview, "\n") {
+			preview += "\n"
+		}
+	}
+	return result.WithText(fmt.Sprintf("%s[output too large (%d bytes, %d lines), the full content was offloaded with handle %q, use the %s tool to page or search through it]",
+		preview, len(text), strings.Count(text, "\n")+1, handle, tool.AgentToolReadOffload)).WithMetadata("offloaded", handle)
+}
+
+// limitToolOutput 按工具的输出策略截断结果。优先使用配置中按工具名指定的策略，其次是工具自己声明的策略，最后是默认策略
+func (a *Agent) limitToolOutput(toolName string, result tool.ToolResult) tool.ToolResult {
+	text := result.Text()
+	limited := a.outputPolicy(toolName).Apply(text)
+	if limited == text {
+		return result
+	}
+	return result.WithText(limited).WithMetadata("truncated", true)
+}
+
+func (a *Agent) outputPolicy(toolName string) tool.OutputPolicy {
+	if policy, ok := a.contextConf.ToolOutputPolicies[toolName]; ok {
+		return policy
+	}
+	if t, ok := a.findTool(toolName); ok {
+		if limiter, ok := t.(tool.OutputLimiter); ok {
+			return limiter.OutputPolicy()
+		}
+	}
+	return a.contextConf.ToolOutputPolicy
+}
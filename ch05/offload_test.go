@@ -0,0 +1,83 @@
+package ch05
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"babyagent/ch05/tool"
+)
+
+func newOffloadTestAgent(t *testing.T) *Agent {
+	t.Helper()
+	conf := NewContextConfig()
+	return &Agent{
+		contextConf:  conf,
+		offloadStore: tool.NewOffloadStore(t.TempDir()),
+		nativeTools:  map[tool.AgentTool]tool.Tool{tool.AgentToolBash: tool.NewBashTool(nil)},
+	}
+}
+
+// commandOutput 模拟一次失败的构建：大量日志之后是错误信息和退出码
+func commandOutput(lines int) string {
+	var b strings.Builder
+	for i := range lines {
+		fmt.Fprintf(&b, "compiling package %04d ... ok\n", i)
+	}
+	b.WriteString("main.go:42: undefined: foo\n[exit code: 1]")
+	return b.String()
+}
+
+func TestOffloadPreviewKeepsTail(t *testing.T) {
+	a := newOffloadTestAgent(t)
+	output := commandOutput(5000)
+
+	result := a.offloadToolResult(tool.AgentToolBash, tool.TextResult(output))
+	result = a.limitToolOutput(tool.AgentToolBash, result)
+	text := result.Text()
+
+	handle, ok := result.Metadata["offloaded"].(string)
+	if !ok {
+		t.Fatalf("result was not offloaded: %v", result.Metadata)
+	}
+	for _, want := range []string{
+		"compiling package 0000 ... ok\n",
+		"main.go:42: undefined: foo\n[exit code: 1]\n",
+		fmt.Sprintf("handle %q", handle),
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("preview does not contain %q:\n%s", want, text)
+		}
+	}
+	if len(text) > a.contextConf.OffloadPreviewBytes+512 {
+		t.Errorf("preview is %d bytes, want about %d", len(text), a.contextConf.OffloadPreviewBytes)
+	}
+
+	saved, err := a.offloadStore.Load(handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved != output {
+		t.Error("offloaded content is not the full output")
+	}
+}
+
+func TestLimitToolOutputKeepsTail(t *testing.T) {
+	a := newOffloadTestAgent(t)
+	a.contextConf.OffloadThresholdBytes = 0 // 关闭卸载，只按输出策略截断
+	output := commandOutput(2000)
+
+	result := a.offloadToolResult(tool.AgentToolBash, tool.TextResult(output))
+	result = a.limitToolOutput(tool.AgentToolBash, result)
+	text := result.Text()
+
+	if result.Metadata["truncated"] != true {
+		t.Fatalf("result was not truncated: %v", result.Metadata)
+	}
+	if !strings.HasSuffix(text, "main.go:42: undefined: foo\n[exit code: 1]") {
+		t.Errorf("tail is lost:\n%s", text[len(text)-200:])
+	}
+	if policy := tool.NewBashTool(nil).OutputPolicy(); len(text) > policy.MaxBytes+256 {
+		t.Errorf("output is %d bytes, want at most about %d", len(text), policy.MaxBytes)
+	}
+}
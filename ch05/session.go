@@ -0,0 +1,336 @@
+package ch05
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go/v3"
+
+	"babyagent/ch05/tool"
+)
+
+const (
+	// sessionFileVersion 会话文件格式的版本，格式不兼容时递增
+	sessionFileVersion = 1
+	sessionFileExt     = ".jsonl"
+	sessionTitleRunes  = 60
+
+	sessionRecordHeader = "session"
+	sessionRecordTurn   = "turn"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionInfo 会话的元信息，对应会话文件的第一行
+type SessionInfo struct {
+	ID        string          `json:"id"`
+	Model     string          `json:"model"`
+	Workspace string          `json:"workspace"`
+	Title     string          `json:"title"`
+	Messages  int             `json:"messages"`        // 当前分支上的消息数
+	Head      int             `json:"head"`            // 当前所在的轮次
+	Todos     []tool.TodoItem `json:"todos,omitempty"` // 模型维护的任务列表
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// sessionRecord 会话文件中的一行：第一行为 header，之后每行一个对话树节点
+type sessionRecord struct {
+	Version int          `json:"version,omitempty"`
+	Type    string       `json:"type"`
+	Session *SessionInfo `json:"session,omitempty"`
+	Turn    *turnNode    `json:"turn,omitempty"`
+}
+
+// DefaultSessionDir 会话默认保存在用户配置目录下按项目区分的目录中
+func DefaultSessionDir(workspace string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	sum := sha1.Sum([]byte(workspace))
+	project := fmt.Sprintf("%s-%s", filepath.Base(workspace), hex.EncodeToString(sum[:4]))
+	return filepath.Join(dir, "babyagent", "projects", project, "sessions")
+}
+
+func newSessionID() string {
+	b := make([]byte, 2)
+	_, _ = rand.Read(b)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// SessionID 当前会话的 id
+func (a *Agent) SessionID() string {
+	return a.session.ID
+}
+
+// SaveSession 将当前会话写入 SessionDir/<id>.jsonl，每次全量重写，先写临时文件再 rename
+func (a *Agent) SaveSession() error {
+	dir := a.contextConf.SessionDir
+	if dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	a.session.Model = a.model
+	if a.session.Title == "" {
+		a.session.Title = sessionTitle(a.messages)
+	}
+	a.session.Messages = len(a.messages)
+	a.session.Head = a.tree.head
+	a.session.Todos = a.todos.Items()
+	a.session.UpdatedAt = time.Now()
+
+	path := filepath.Join(dir, a.session.ID+sessionFileExt)
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	encoder := json.NewEncoder(w)
+	err = encoder.Encode(sessionRecord{Version: sessionFileVersion, Type: sessionRecordHeader, Session: &a.session})
+	for _, turn := range a.tree.turns {
+		if err != nil {
+			break
+		}
+		err = encoder.Encode(sessionRecord{Type: sessionRecordTurn, Turn: turn})
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ListSessions 列出当前项目保存的会话，最近更新的在前
+func (a *Agent) ListSessions() ([]SessionInfo, error) {
+	dir := a.contextConf.SessionDir
+	if dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]SessionInfo, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), sessionFileExt) {
+			continue
+		}
+		info, err := readSessionHeader(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, info)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt)
+	})
+	return sessions, nil
+}
+
+// ResumeSession 从磁盘恢复会话，id 为 latest 时恢复最近更新的会话。system prompt 会按当前环境重新生成
+func (a *Agent) ResumeSession(id string) error {
+	if id == "latest" {
+		sessions, err := a.ListSessions()
+		if err != nil {
+			return err
+		}
+		if len(sessions) == 0 {
+			return ErrSessionNotFound
+		}
+		id = sessions[0].ID
+	}
+	if a.contextConf.SessionDir == "" || strings.ContainsAny(id, `/\`) {
+		return ErrSessionNotFound
+	}
+
+	info, tree, err := readSessionFile(filepath.Join(a.contextConf.SessionDir, id+sessionFileExt))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	prompt, err := a.buildSystemPrompt()
+	if err != nil {
+		return err
+	}
+	tree.turns[0].Messages[0] = openai.SystemMessage(prompt)
+
+	if err := a.offloadStore.Clear(); err != nil {
+		return err
+	}
+	if err := a.closeToolResources(); err != nil {
+		return err
+	}
+	a.session = info
+	a.tree = tree
+	a.messages, a.messageTimes = tree.messages(tree.head)
+	a.usage = SessionUsage{}
+	a.compactedTokens = 0
+	a.todos.Set(info.Todos)
+	return nil
+}
+
+// History 将当前会话的消息转换为 MessageVO，用于恢复会话后重建界面
+func (a *Agent) History() []MessageVO {
+	history := make([]MessageVO, 0)
+	for _, message := range a.messages {
+		switch {
+		case message.OfUser != nil:
+			content := message.OfUser.Content.OfString.Value
+			if summary, ok := strings.CutPrefix(content, compactSummaryPrefix); ok {
+				summary, _, _ = strings.Cut(summary, compactTodoHeader)
+				history = append(history, MessageVO{Type: MessageTypeCompact, Content: &summary})
+				continue
+			}
+			history = append(history, MessageVO{Type: MessageTypeUser, Content: &content})
+		case message.OfAssistant != nil:
+			if content := message.OfAssistant.Content.OfString.Value; content != "" {
+				history = append(history, MessageVO{Type: MessageTypeContent, Content: &content})
+			}
+			for _, toolCall := range message.OfAssistant.ToolCalls {
+				if toolCall.OfFunction == nil {
+					continue
+				}
+				history = append(history, MessageVO{
+					Type: MessageTypeToolCall,
+					ToolCall: &ToolCallVO{
+						Name:      toolCall.OfFunction.Function.Name,
+						Arguments: toolCall.OfFunction.Function.Arguments,
+					},
+				})
+			}
+		}
+	}
+	return history
+}
+
+func readSessionHeader(path string) (SessionInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return SessionInfo{}, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return SessionInfo{}, err
+	}
+	return parseSessionHeader(line)
+}
+
+func parseSessionHeader(line []byte) (SessionInfo, error) {
+	record := sessionRecord{}
+	if err := json.Unmarshal(line, &record); err != nil {
+		return SessionInfo{}, err
+	}
+	if record.Type != sessionRecordHeader || record.Session == nil {
+		return SessionInfo{}, errors.New("invalid session header")
+	}
+	if record.Version != sessionFileVersion {
+		return SessionInfo{}, fmt.Errorf("unsupported session file version %d", record.Version)
+	}
+	return *record.Session, nil
+}
+
+func readSessionFile(path string) (SessionInfo, *conversationTree, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return SessionInfo{}, nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return SessionInfo{}, nil, err
+	}
+	info, err := parseSessionHeader(line)
+	if err != nil {
+		return SessionInfo{}, nil, err
+	}
+
+	tree := &conversationTree{turns: make([]*turnNode, 0)}
+	decoder := json.NewDecoder(reader)
+	for decoder.More() {
+		record := sessionRecord{}
+		if err := decoder.Decode(&record); err != nil {
+			return SessionInfo{}, nil, err
+		}
+		if record.Type != sessionRecordTurn || record.Turn == nil {
+			continue
+		}
+		if err := validateTurn(record.Turn, len(tree.turns)); err != nil {
+			return SessionInfo{}, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		tree.turns = append(tree.turns, record.Turn)
+	}
+
+	if len(tree.turns) == 0 || len(tree.turns[0].Messages) == 0 || tree.turns[0].Messages[0].OfSystem == nil {
+		return SessionInfo{}, nil, fmt.Errorf("session %s has no system prompt", info.ID)
+	}
+	if _, err := tree.get(info.Head); err != nil {
+		return SessionInfo{}, nil, err
+	}
+	tree.head = info.Head
+	return info, tree, nil
+}
+
+// validateTurn 检查从文件读取的节点：id 按顺序递增，根节点没有父节点，其他节点的父节点在它之前，
+// 保证沿 Parent 向上查找时不会越界或者成环
+func validateTurn(turn *turnNode, id int) error {
+	if turn.ID != id {
+		return fmt.Errorf("turn %d is out of order, expected turn %d", turn.ID, id)
+	}
+	if id == 0 && turn.Parent != -1 || id > 0 && (turn.Parent < 0 || turn.Parent >= id) {
+		return fmt.Errorf("turn %d has an invalid parent %d", turn.ID, turn.Parent)
+	}
+	if len(turn.Times) != len(turn.Messages) {
+		return fmt.Errorf("turn %d has %d messages but %d timestamps", turn.ID, len(turn.Messages), len(turn.Times))
+	}
+	return nil
+}
+
+// sessionTitle 取第一条用户输入作为会话标题
+func sessionTitle(messages []openai.ChatCompletionMessageParamUnion) string {
+	for _, message := range messages {
+		if message.OfUser == nil {
+			continue
+		}
+		title := []rune(strings.Join(strings.Fields(message.OfUser.Content.OfString.Value), " "))
+		if strings.HasPrefix(string(title), compactSummaryPrefix[:len(compactSummaryPrefix)-1]) {
+			continue
+		}
+		if len(title) > sessionTitleRunes {
+			return string(title[:sessionTitleRunes]) + "..."
+		}
+		return string(title)
+	}
+	return ""
+}
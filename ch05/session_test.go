@@ -0,0 +1,156 @@
+package ch05
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go/v3"
+
+	"babyagent/ch05/tool"
+	"babyagent/shared"
+)
+
+func newSessionTestAgent(t *testing.T, sessionDir string) *Agent {
+	t.Helper()
+	a, err := NewAgent(
+		shared.ModelConfig{Model: "test-model"},
+		ContextConfig{SessionDir: sessionDir, OffloadDir: t.TempDir()},
+		nil,
+		"test prompt",
+		nil,
+		nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = a.Close() })
+	return a
+}
+
+// addTestTurn 在当前 head 之后追加一轮对话：用户输入和模型回答
+func addTestTurn(a *Agent, query string) {
+	a.appendMessage(openai.UserMessage(query))
+	a.appendMessage(openai.AssistantMessage("answer to " + query))
+}
+
+// messageTexts 当前分支上所有 user 和 assistant 消息的文本
+func messageTexts(a *Agent) []string {
+	texts := make([]string, 0)
+	for _, message := range a.messages {
+		switch {
+		case message.OfUser != nil:
+			texts = append(texts, message.OfUser.Content.OfString.Value)
+		case message.OfAssistant != nil:
+			texts = append(texts, message.OfAssistant.Content.OfString.Value)
+		}
+	}
+	return texts
+}
+
+func TestSessionRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	a := newSessionTestAgent(t, dir)
+	addTestTurn(a, "first")
+	addTestTurn(a, "second")
+	// 回到第一轮之后继续对话，产生新的分支
+	if err := a.Checkout(1); err != nil {
+		t.Fatal(err)
+	}
+	addTestTurn(a, "other")
+	a.todos.Set([]tool.TodoItem{{Content: "write tests", Status: tool.TodoStatusInProgress}})
+	if err := a.SaveSession(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := newSessionTestAgent(t, dir)
+	if err := b.ResumeSession("latest"); err != nil {
+		t.Fatal(err)
+	}
+	if b.SessionID() != a.SessionID() {
+		t.Errorf("session id: got %s, want %s", b.SessionID(), a.SessionID())
+	}
+	if want := []string{"first", "answer to first", "other", "answer to other"}; !slices.Equal(messageTexts(b), want) {
+		t.Errorf("messages of the resumed branch:\ngot  %q\nwant %q", messageTexts(b), want)
+	}
+	if len(b.messageTimes) != len(b.messages) {
+		t.Errorf("%d messages but %d timestamps", len(b.messages), len(b.messageTimes))
+	}
+	if got := b.Todos(); len(got) != 1 || got[0].Content != "write tests" {
+		t.Errorf("todos: %+v", got)
+	}
+	heads := make([]int, 0)
+	for _, branch := range b.Branches() {
+		heads = append(heads, branch.Head)
+	}
+	if !slices.Equal(heads, []int{2, 3}) {
+		t.Errorf("branch heads: got %v, want [2 3]", heads)
+	}
+
+	// 恢复后切换到另一个分支继续对话
+	if err := b.Checkout(2); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"first", "answer to first", "second", "answer to second"}; !slices.Equal(messageTexts(b), want) {
+		t.Errorf("messages after checkout:\ngot  %q\nwant %q", messageTexts(b), want)
+	}
+	addTestTurn(b, "third")
+	if got := b.CurrentTurn(); got != 4 {
+		t.Errorf("new turn id: got %d, want 4", got)
+	}
+	if got := b.tree.turns[4].Parent; got != 2 {
+		t.Errorf("new turn parent: got %d, want 2", got)
+	}
+
+	sessions, err := b.ListSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].Title != "first" {
+		t.Errorf("sessions: %+v", sessions)
+	}
+}
+
+func TestResumeSessionRejectsMalformedFiles(t *testing.T) {
+	header := `{"version":1,"type":"session","session":{"id":"s","head":%d}}`
+	root := `{"type":"turn","turn":{"id":0,"parent":-1,"messages":[{"role":"system","content":"p"}],"times":["2026-01-01T00:00:00Z"]}}`
+	turn := func(id, parent int) string {
+		return strings.NewReplacer("ID", strconv.Itoa(id), "PARENT", strconv.Itoa(parent)).Replace(
+			`{"type":"turn","turn":{"id":ID,"parent":PARENT,"messages":[{"role":"user","content":"q"}],"times":["2026-01-01T00:00:00Z"]}}`)
+	}
+	tests := []struct {
+		name  string
+		lines []string
+		err   string
+	}{
+		{name: "parent before the root", lines: []string{fmt.Sprintf(header, 1), root, turn(1, -2)}, err: "invalid parent -2"},
+		{name: "parent is the turn itself", lines: []string{fmt.Sprintf(header, 1), root, turn(1, 1)}, err: "invalid parent 1"},
+		{name: "parent after the turn", lines: []string{fmt.Sprintf(header, 1), root, turn(1, 2), turn(2, 1)}, err: "invalid parent 2"},
+		{name: "second root", lines: []string{fmt.Sprintf(header, 1), root, turn(1, -1)}, err: "invalid parent -1"},
+		{name: "root with a parent", lines: []string{fmt.Sprintf(header, 0), strings.Replace(root, `"parent":-1`, `"parent":0`, 1)}, err: "invalid parent 0"},
+		{name: "turns out of order", lines: []string{fmt.Sprintf(header, 1), root, turn(2, 0)}, err: "out of order"},
+		{name: "timestamps do not match the messages", lines: []string{fmt.Sprintf(header, 0), strings.Replace(root, `"times":["2026-01-01T00:00:00Z"]`, `"times":[]`, 1)}, err: "timestamps"},
+		{name: "head out of range", lines: []string{fmt.Sprintf(header, 5), root}, err: "turn 5 not found"},
+		{name: "no system prompt", lines: []string{fmt.Sprintf(header, 0)}, err: "no system prompt"},
+		{name: "unsupported version", lines: []string{strings.Replace(fmt.Sprintf(header, 0), `"version":1`, `"version":2`, 1), root}, err: "unsupported session file version 2"},
+		{name: "linear message records", lines: []string{fmt.Sprintf(header, 0), `{"type":"message","message":{"role":"system","content":"p"}}`}, err: "no system prompt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			content := strings.Join(tt.lines, "\n") + "\n"
+			if err := os.WriteFile(filepath.Join(dir, "s"+sessionFileExt), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			a := newSessionTestAgent(t, dir)
+			err := a.ResumeSession("s")
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package ch05
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"babyagent/ch05/tool"
+)
+
+const (
+	// envCommandTimeout 收集 git、go 等环境信息时单个命令的超时时间
+	envCommandTimeout = 2 * time.Second
+	// maxListingEntries 目录列表最多展示的条目数
+	maxListingEntries = 50
+)
+
+// buildSystemPrompt 使用 text/template 渲染 system prompt，模板中引用了不存在的变量时返回错误
+func (a *Agent) buildSystemPrompt() (string, error) {
+	tmpl, err := template.New("system_prompt").
+		Funcs(template.FuncMap{"join": strings.Join}).
+		Option("missingkey=error").
+		Parse(a.systemPrompt)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse system prompt: %w", err)
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, a.promptVars()); err != nil {
+		return "", fmt.Errorf("failed to render system prompt: %w", err)
+	}
+	return b.String(), nil
+}
+
+// promptVars 模板中可以使用的变量
+func (a *Agent) promptVars() map[string]any {
+	cwd, _ := os.Getwd()
+	branch, dirty := gitStatus(cwd)
+	return map[string]any{
+		"runtime":           runtime.GOOS,
+		"workspace_path":    cwd,
+		"date":              time.Now().Format("2006-01-02 (Monday)"),
+		"shell":             currentShell(),
+		"git_branch":        branch,
+		"git_dirty":         dirty,
+		"directory_listing": directoryListing(cwd),
+		"go_version":        goVersion(),
+		"tools":             a.toolNames(),
+		"memories":          a.promptMemories(),
+		"instructions":      renderInstructions(loadInstructionFiles(a.contextConf, cwd)),
+	}
+}
+
+// promptMemories 会话开始时注入的长期记忆
+func (a *Agent) promptMemories() string {
+	memories, err := a.memoryStore.Search("", "", a.contextConf.PromptMemoryLimit)
+	if err != nil {
+		log.Printf("failed to load memories: %v", err)
+	}
+	if len(memories) == 0 {
+		return "(no memories yet)"
+	}
+	return tool.FormatMemories(memories)
+}
+
+func (a *Agent) toolNames() []string {
+	names := make([]string, 0)
+	for name := range a.nativeTools {
+		names = append(names, name)
+	}
+	for _, mcpClient := range a.mcpClients {
+		for _, t := range mcpClient.GetTools() {
+			names = append(names, t.ToolName())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func currentShell() string {
+	if runtime.GOOS == "windows" {
+		if comSpec := os.Getenv("ComSpec"); comSpec != "" {
+			return comSpec
+		}
+		return "cmd"
+	}
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	return "sh"
+}
+
+// gitStatus 返回当前分支以及工作区是否有未提交的修改，不在 git 仓库中时返回空分支
+func gitStatus(dir string) (string, bool) {
+	branch, err := runEnvCommand(dir, "git", "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", false
+	}
+	status, err := runEnvCommand(dir, "git", "status", "--porcelain")
+	if err != nil {
+		return branch, false
+	}
+	return branch, status != ""
+}
+
+func goVersion() string {
+	version, err := runEnvCommand("", "go", "env", "GOVERSION")
+	if err != nil {
+		return "not installed"
+	}
+	return version
+}
+
+func runEnvCommand(dir string, name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), envCommandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// directoryListing 列出工作目录下的顶层文件和目录，目录以 / 结尾，忽略隐藏文件
+func directoryListing(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Sprintf("(failed to list directory: %v)", err)
+	}
+
+	var b strings.Builder
+	count := 0
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if count == maxListingEntries {
+			fmt.Fprintf(&b, "- ... (more than %d entries)\n", maxListingEntries)
+			break
+		}
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		fmt.Fprintf(&b, "- %s\n", name)
+		count++
+	}
+	if count == 0 {
+		return "(empty)"
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
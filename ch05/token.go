@@ -0,0 +1,48 @@
+package ch05
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/openai/openai-go/v3"
+
+	"babyagent/ch05/tokenizer"
+)
+
+// messageOverheadTokens 每条消息除内容外的固定开销（role、分隔符等）
+const messageOverheadTokens = 4
+
+// estimateMessageTokens 估算单条消息的 token 数，包括 content 和 tool_calls
+func estimateMessageTokens(counter tokenizer.Tokenizer, message openai.ChatCompletionMessageParamUnion) int {
+	return counter.Count(messageText(message)) + messageOverheadTokens
+}
+
+func estimateMessagesTokens(counter tokenizer.Tokenizer, messages []openai.ChatCompletionMessageParamUnion) int {
+	total := 0
+	for _, message := range messages {
+		total += estimateMessageTokens(counter, message)
+	}
+	return total
+}
+
+// messageText 提取消息中会占用上下文的文本
+func messageText(message openai.ChatCompletionMessageParamUnion) string {
+	var b strings.Builder
+	switch content := message.GetContent().AsAny().(type) {
+	case *string:
+		b.WriteString(*content)
+	case nil:
+	default:
+		// 多模态等 content parts 数组，直接按 JSON 估算
+		raw, _ := json.Marshal(content)
+		b.Write(raw)
+	}
+	for _, toolCall := range message.GetToolCalls() {
+		if toolCall.OfFunction == nil {
+			continue
+		}
+		b.WriteString(toolCall.OfFunction.Function.Name)
+		b.WriteString(toolCall.OfFunction.Function.Arguments)
+	}
+	return b.String()
+}
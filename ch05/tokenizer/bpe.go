@@ -0,0 +1,196 @@
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 与 tiktoken 相同的预切分正则。Go 的 regexp 不支持 \s+(?!\S)，在 split 中单独处理
+var splitPatterns = map[string]string{
+	EncodingCl100kBase: `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`,
+	EncodingO200kBase: strings.Join([]string{
+		`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?`,
+		`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?`,
+		`\p{N}{1,3}`,
+		` ?[^\s\p{L}\p{N}]+[\r\n/]*`,
+		`\s*[\r\n]+`,
+		`\s+`,
+	}, "|"),
+}
+
+// BPE 与 tiktoken 兼容的 byte pair encoding
+type BPE struct {
+	name    string
+	ranks   map[string]int
+	pattern *regexp.Regexp
+}
+
+// LoadBPE 加载 tiktoken 格式的词表文件，每行为 base64 编码的 token 和它的 rank
+func LoadBPE(name string, path string) (*BPE, error) {
+	pattern, ok := splitPatterns[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding %q", name)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		token, rank, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid line in %s: %q", path, line)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, err
+		}
+		r, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, err
+		}
+		ranks[string(decoded)] = r
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return &BPE{
+		name:    name,
+		ranks:   ranks,
+		pattern: regexp.MustCompile(pattern),
+	}, nil
+}
+
+func (e *BPE) Name() string {
+	return e.name
+}
+
+func (e *BPE) Count(text string) int {
+	return len(e.Encode(text))
+}
+
+// Encode 将文本编码为 token id 序列，不处理特殊 token
+func (e *BPE) Encode(text string) []int {
+	tokens := make([]int, 0, len(text)/3)
+	for _, piece := range e.split(text) {
+		if rank, ok := e.ranks[piece]; ok {
+			tokens = append(tokens, rank)
+			continue
+		}
+		tokens = append(tokens, e.bytePairMerge(piece)...)
+	}
+	return tokens
+}
+
+// split 预切分文本。对于后面紧跟非空白字符的空白串，最后一个空白字符留给下一个片段，效果等同于 \s+(?!\S)
+func (e *BPE) split(text string) []string {
+	pieces := make([]string, 0)
+	for pos := 0; pos < len(text); {
+		loc := e.pattern.FindStringIndex(text[pos:])
+		if loc == nil || loc[1] == 0 {
+			// 正则覆盖了所有字符，这里只是兜底
+			_, size := utf8.DecodeRuneInString(text[pos:])
+			pieces = append(pieces, text[pos:pos+size])
+			pos += size
+			continue
+		}
+		end := pos + loc[1]
+		piece := text[pos:end]
+		if end < len(text) && isTrailingSpaceRun(piece) {
+			_, size := utf8.DecodeLastRuneInString(piece)
+			if size < len(piece) {
+				end -= size
+				piece = piece[:len(piece)-size]
+			}
+		}
+		pieces = append(pieces, piece)
+		pos = end
+	}
+	return pieces
+}
+
+// isTrailingSpaceRun 片段全部是空白字符，并且不是以换行结尾
+func isTrailingSpaceRun(piece string) bool {
+	for _, r := range piece {
+		if !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	last := piece[len(piece)-1]
+	return last != '\n' && last != '\r'
+}
+
+// bytePairMerge 与 tiktoken 的 _byte_pair_merge 相同：不断合并 rank 最小的相邻片段
+func (e *BPE) bytePairMerge(piece string) []int {
+	type part struct {
+		start int
+		rank  int
+	}
+
+	rankOf := func(parts []part, i int) int {
+		if i+3 < len(parts) {
+			if rank, ok := e.ranks[piece[parts[i].start:parts[i+3].start]]; ok {
+				return rank
+			}
+		}
+		return math.MaxInt
+	}
+
+	parts := make([]part, 0, len(piece)+1)
+	minRank, minIndex := math.MaxInt, -1
+	for i := 0; i < len(piece)-1; i++ {
+		rank := math.MaxInt
+		if r, ok := e.ranks[piece[i:i+2]]; ok {
+			rank = r
+		}
+		if rank < minRank {
+			minRank, minIndex = rank, i
+		}
+		parts = append(parts, part{start: i, rank: rank})
+	}
+	parts = append(parts, part{start: len(piece) - 1, rank: math.MaxInt}, part{start: len(piece), rank: math.MaxInt})
+
+	for minRank != math.MaxInt {
+		i := minIndex
+		if i > 0 {
+			parts[i-1].rank = rankOf(parts, i-1)
+		}
+		parts[i].rank = rankOf(parts, i)
+		parts = append(parts[:i+1], parts[i+2:]...)
+
+		minRank, minIndex = math.MaxInt, -1
+		for j := 0; j < len(parts)-1; j++ {
+			if parts[j].rank < minRank {
+				minRank, minIndex = parts[j].rank, j
+			}
+		}
+	}
+
+	tokens := make([]int, 0, len(parts)-1)
+	for i := 0; i < len(parts)-1; i++ {
+		if rank, ok := e.ranks[piece[parts[i].start:parts[i+1].start]]; ok {
+			tokens = append(tokens, rank)
+		} else {
+			// 词表不完整时记为未知 token
+			tokens = append(tokens, -1)
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,218 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// loadTestBPE 从词表缓存目录加载编码，词表不存在时跳过测试
+func loadTestBPE(t *testing.T, encoding string) *BPE {
+	t.Helper()
+	path := filepath.Join(cacheDir(), encoding+".tiktoken")
+	if _, err := os.Stat(path); err != nil {
+		t.Skipf("%s not found, set TIKTOKEN_CACHE_DIR to a directory containing %s.tiktoken", path, encoding)
+	}
+	bpe, err := LoadBPE(encoding, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bpe
+}
+
+// 期望值为 tiktoken 对同样文本的编码结果
+func TestBPEEncodeMatchesTiktoken(t *testing.T) {
+	tests := []struct {
+		encoding string
+		text     string
+		want     []int
+	}{
+		{EncodingCl100kBase, "hello world", []int{15339, 1917}},
+		{EncodingCl100kBase, "Hello, world!", []int{9906, 11, 1917, 0}},
+		{EncodingCl100kBase, "  leading spaces and trailing   ", []int{220, 6522, 12908, 323, 28848, 262}},
+		{EncodingCl100kBase, "func main() {\n\tfmt.Println(\"hi\")\n}\n", []int{2900, 1925, 368, 341, 11254, 12701, 446, 6151, 1158, 534}},
+		{EncodingCl100kBase, "12345678 3.14159", []int{4513, 10961, 2495, 220, 18, 13, 9335, 2946}},
+		{EncodingCl100kBase, "I'm can't we'll THEY'RE", []int{40, 2846, 649, 956, 584, 3358, 63593, 95253}},
+		{EncodingCl100kBase, "中文分词测试，汉字", []int{16325, 17161, 17620, 6744, 235, 82805, 3922, 21980, 231, 19113}},
+		{EncodingCl100kBase, "emoji 🎉🚀 done", []int{38623, 11410, 236, 231, 9468, 248, 222, 2884}},
+		{EncodingCl100kBase, "line1\r\n\r\nline2\n\n\n", []int{1074, 16, 881, 1074, 17, 1432}},
+		{EncodingCl100kBase, "path/to/file.go:42", []int{2398, 33529, 24849, 18487, 25, 2983}},
+		{EncodingO200kBase, "hello world", []int{24912, 2375}},
+		{EncodingO200kBase, "Hello, world!", []int{13225, 11, 2375, 0}},
+		{EncodingO200kBase, "  leading spaces and trailing   ", []int{220, 8117, 18608, 326, 57985, 271}},
+		{EncodingO200kBase, "func main() {\n\tfmt.Println(\"hi\")\n}\n", []int{5652, 2758, 416, 405, 24728, 28250, 568, 3686, 1896, 739}},
+		{EncodingO200kBase, "12345678 3.14159", []int{7633, 19354, 4388, 220, 18, 13, 16926, 4621}},
+		{EncodingO200kBase, "I'm can't we'll THEY'RE", []int{15390, 8535, 22782, 95381, 6, 1099}},
+		{EncodingO200kBase, "中文分词测试，汉字", []int{10667, 2957, 31892, 82843, 979, 47799, 8134}},
+		{EncodingO200kBase, "emoji 🎉🚀 done", []int{75339, 139786, 231, 112927, 222, 4167}},
+		{EncodingO200kBase, "line1\r\n\r\nline2\n\n\n", []int{1137, 16, 1414, 1137, 17, 2499}},
+		{EncodingO200kBase, "path/to/file.go:42", []int{4189, 72231, 51766, 32812, 25, 4689}},
+	}
+	loaded := make(map[string]*BPE)
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%q", tt.encoding, tt.text), func(t *testing.T) {
+			bpe, ok := loaded[tt.encoding]
+			if !ok {
+				bpe = loadTestBPE(t, tt.encoding)
+				loaded[tt.encoding] = bpe
+			}
+			if got := bpe.Encode(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("Encode(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+// writeTestVocab 写入一个很小的词表，覆盖所有单字节和给定的合并结果，rank 越小越先合并
+func writeTestVocab(t *testing.T, merges []string) string {
+	t.Helper()
+	var b strings.Builder
+	for i := range 256 {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(i)}), i)
+	}
+	for i, merge := range merges {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(merge)), 256+i)
+	}
+	path := filepath.Join(t.TempDir(), "test.tiktoken")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBPEMergeOrder(t *testing.T) {
+	// "ab" 的 rank 比 "bc" 小，"abc" 应先合并为 ab + c，再合并为 abc
+	path := writeTestVocab(t, []string{"ab", "bc", "abc", " x"})
+	bpe, err := LoadBPE(EncodingCl100kBase, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text string
+		want []int
+	}{
+		{"a", []int{'a'}},
+		{"abc", []int{258}},
+		{"bc", []int{257}},
+		{"abcb", []int{258, 'b'}},
+		{"cab", []int{'c', 256}},
+		{" x", []int{259}},
+		{"é", []int{0xc3, 0xa9}},
+	}
+	for _, tt := range tests {
+		if got := bpe.Encode(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("Encode(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+		if got := bpe.Count(tt.text); got != len(tt.want) {
+			t.Errorf("Count(%q) = %d, want %d", tt.text, got, len(tt.want))
+		}
+	}
+}
+
+// 期望值为 tiktoken 预切分正则对同样文本的切分结果，只依赖正则，不需要完整词表
+func TestBPESplit(t *testing.T) {
+	tests := []struct {
+		encoding string
+		text     string
+		want     []string
+	}{
+		{EncodingCl100kBase, "hello world", []string{"hello", " world"}},
+		{EncodingCl100kBase, "Hello, world!", []string{"Hello", ",", " world", "!"}},
+		{EncodingCl100kBase, "  leading spaces and trailing   ", []string{" ", " leading", " spaces", " and", " trailing", "   "}},
+		{EncodingCl100kBase, "12345678 3.14159", []string{"123", "456", "78", " ", "3", ".", "141", "59"}},
+		{EncodingCl100kBase, "I'm can't we'll THEY'RE", []string{"I", "'m", " can", "'t", " we", "'ll", " THEY", "'RE"}},
+		{EncodingCl100kBase, "line1\r\n\r\nline2\n\n\n", []string{"line", "1", "\r\n\r\n", "line", "2", "\n\n\n"}},
+		{EncodingCl100kBase, "a  \n\tb", []string{"a", "  \n", "\tb"}},
+		{EncodingCl100kBase, "path/to/file.go:42", []string{"path", "/to", "/file", ".go", ":", "42"}},
+		{EncodingCl100kBase, "HelloWorld 中文，汉字", []string{"HelloWorld", " 中文", "，汉字"}},
+		{EncodingO200kBase, "hello world", []string{"hello", " world"}},
+		{EncodingO200kBase, "I'm can't we'll THEY'RE", []string{"I'm", " can't", " we'll", " THEY'RE"}},
+		{EncodingO200kBase, "12345678 3.14159", []string{"123", "456", "78", " ", "3", ".", "141", "59"}},
+		{EncodingO200kBase, "path/to/file.go:42", []string{"path", "/to", "/file", ".go", ":", "42"}},
+		{EncodingO200kBase, "HelloWorld getHTTPResponse", []string{"Hello", "World", " get", "HTTPResponse"}},
+		{EncodingO200kBase, "a  \n\tb", []string{"a", "  \n", "\tb"}},
+	}
+	path := writeTestVocab(t, nil)
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%q", tt.encoding, tt.text), func(t *testing.T) {
+			bpe, err := LoadBPE(tt.encoding, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := bpe.split(tt.text)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("split(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+			if strings.Join(got, "") != tt.text {
+				t.Errorf("split(%q) lost characters: %q", tt.text, got)
+			}
+		})
+	}
+}
+
+func TestBPEBytePairMerge(t *testing.T) {
+	// rank 越小越先合并："aa" 先于 "ab"，"aaab" 先合并出两个 "aa"
+	path := writeTestVocab(t, []string{"aa", "ab", "aaaa", "bb", "abb"})
+	bpe, err := LoadBPE(EncodingCl100kBase, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		piece string
+		want  []int
+	}{
+		{"a", []int{'a'}},
+		{"ab", []int{257}},
+		{"aaa", []int{256, 'a'}},
+		{"aaab", []int{256, 257}},
+		{"aaaa", []int{258}},
+		{"aaaaa", []int{258, 'a'}},
+		{"abb", []int{260}},
+		{"abbb", []int{257, 259}},
+		{"xyz", []int{'x', 'y', 'z'}},
+	}
+	for _, tt := range tests {
+		if got := bpe.bytePairMerge(tt.piece); !slices.Equal(got, tt.want) {
+			t.Errorf("bytePairMerge(%q) = %v, want %v", tt.piece, got, tt.want)
+		}
+	}
+
+	// 词表不完整时缺失的字节记为 -1
+	partial := &BPE{name: EncodingCl100kBase, ranks: map[string]int{"a": 0, "ab": 1}}
+	if got := partial.bytePairMerge("abc"); !slices.Equal(got, []int{1, -1}) {
+		t.Errorf("bytePairMerge with a partial vocabulary = %v, want [1 -1]", got)
+	}
+}
+
+func TestLoadBPEInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.tiktoken")
+	if err := os.WriteFile(path, []byte("YQ==\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadBPE(EncodingCl100kBase, path); err == nil {
+		t.Error("expected an error for a line without rank")
+	}
+	if _, err := LoadBPE("unknown", path); err == nil {
+		t.Error("expected an error for an unknown encoding")
+	}
+}
+
+func TestEncodingForModel(t *testing.T) {
+	tests := map[string]string{
+		"gpt-4o-mini":   EncodingO200kBase,
+		"openai/gpt-5":  EncodingO200kBase,
+		"GPT-4-turbo":   EncodingCl100kBase,
+		"gpt-3.5-turbo": EncodingCl100kBase,
+		"o3-mini":       EncodingO200kBase,
+		"claude-3":      "",
+	}
+	for model, want := range tests {
+		if got := EncodingForModel(model); got != want {
+			t.Errorf("EncodingForModel(%q) = %q, want %q", model, got, want)
+		}
+	}
+}
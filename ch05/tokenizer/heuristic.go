@@ -0,0 +1,22 @@
+package tokenizer
+
+import "unicode/utf8"
+
+// Heuristic 粗略估算 token 数：ASCII 字符约 4 个一个 token，其余字符（如中文）约 1 个一个 token
+type Heuristic struct{}
+
+func (Heuristic) Name() string {
+	return "heuristic"
+}
+
+func (Heuristic) Count(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
@@ -0,0 +1,99 @@
+// Package tokenizer 用于估算文本的 token 数。
+//
+// OpenAI 模型使用与 tiktoken 兼容的 BPE 编码，词表文件（如 o200k_base.tiktoken）需要放在
+// $TIKTOKEN_CACHE_DIR 或者用户缓存目录下的 babyagent/tiktoken 目录中，找不到词表或者是其他模型时，
+// 退化为基于字符数的估算。
+package tokenizer
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	EncodingCl100kBase = "cl100k_base"
+	EncodingO200kBase  = "o200k_base"
+)
+
+// Tokenizer 统计文本的 token 数
+type Tokenizer interface {
+	Name() string
+	Count(text string) int
+}
+
+// modelEncodings 模型名前缀对应的编码，前缀越长越优先匹配
+var modelEncodings = []struct {
+	prefix   string
+	encoding string
+}{
+	{"gpt-4o", EncodingO200kBase},
+	{"gpt-4.1", EncodingO200kBase},
+	{"gpt-4.5", EncodingO200kBase},
+	{"gpt-5", EncodingO200kBase},
+	{"o1", EncodingO200kBase},
+	{"o3", EncodingO200kBase},
+	{"o4", EncodingO200kBase},
+	{"gpt-4", EncodingCl100kBase},
+	{"gpt-3.5", EncodingCl100kBase},
+	{"text-embedding-3", EncodingCl100kBase},
+}
+
+var (
+	encodingsMu sync.Mutex
+	encodings   = make(map[string]*BPE)
+)
+
+// ForModel 返回模型对应的 Tokenizer，不是 OpenAI 模型或者词表不可用时返回 Heuristic
+func ForModel(model string) Tokenizer {
+	encoding := EncodingForModel(model)
+	if encoding == "" {
+		return Heuristic{}
+	}
+
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+	if bpe, ok := encodings[encoding]; ok {
+		if bpe == nil {
+			return Heuristic{}
+		}
+		return bpe
+	}
+
+	bpe, err := LoadBPE(encoding, filepath.Join(cacheDir(), encoding+".tiktoken"))
+	if err != nil {
+		log.Printf("failed to load %s encoding, fallback to heuristic: %v", encoding, err)
+		encodings[encoding] = nil
+		return Heuristic{}
+	}
+	encodings[encoding] = bpe
+	return bpe
+}
+
+// EncodingForModel 返回模型使用的 BPE 编码名，未知模型返回空字符串
+func EncodingForModel(model string) string {
+	model = strings.ToLower(model)
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		// 兼容 openai/gpt-4o 这类带供应商前缀的模型名
+		model = model[i+1:]
+	}
+	for _, e := range modelEncodings {
+		if strings.HasPrefix(model, e.prefix) {
+			return e.encoding
+		}
+	}
+	return ""
+}
+
+func cacheDir() string {
+	if dir := os.Getenv("TIKTOKEN_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return os.TempDir()
+	}
+	return filepath.Join(dir, "babyagent", "tiktoken")
+}
@@ -0,0 +1,437 @@
+package tool
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+var codeFencePattern = regexp.MustCompile("(?s)^```[a-zA-Z0-9_-]*\\s*\n?(.*?)\\s*```$")
+
+// ArgumentProblem 一个不符合 schema 的参数
+type ArgumentProblem struct {
+	Path    string // 参数路径，例如 todos[1].status
+	Message string
+}
+
+// ArgumentError 工具参数无法解析或者不符合 schema，列出发现的问题，返回给模型用于修正
+type ArgumentError struct {
+	Problems []ArgumentProblem
+}
+
+func (e *ArgumentError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid tool arguments:\n")
+	for _, problem := range e.Problems {
+		if problem.Path == "" {
+			fmt.Fprintf(&b, "- %s\n", problem.Message)
+			continue
+		}
+		fmt.Fprintf(&b, "- %s: %s\n", problem.Path, problem.Message)
+	}
+	b.WriteString("fix the listed arguments and call the tool again")
+	return b.String()
+}
+
+// ValidateArguments 按工具声明的 JSON Schema 校验参数，先修复模型常见的格式问题：
+// 代码块包裹的 JSON、多余的结尾逗号、字符串形式的数字和布尔值、带小数点的整数、字符串形式的嵌套对象或数组、可选参数传入 null。
+// 修复由 repairValue 完成，校验使用 jsonschema-go。返回修复后的参数和修复说明，参数不合法时返回 *ArgumentError
+func ValidateArguments(schema map[string]any, arguments string) (string, []string, error) {
+	repairs := make([]string, 0)
+	text := strings.TrimSpace(arguments)
+	if match := codeFencePattern.FindStringSubmatch(text); match != nil {
+		text = strings.TrimSpace(match[1])
+		repairs = append(repairs, "removed code fence")
+	}
+	if text == "" {
+		text = "{}"
+	}
+
+	value, err := decodeArguments(text)
+	if err != nil {
+		if fixed := removeTrailingCommas(text); fixed != text {
+			if v, fixedErr := decodeArguments(fixed); fixedErr == nil {
+				value, err = v, nil
+				repairs = append(repairs, "removed trailing commas")
+			}
+		}
+	}
+	if err != nil {
+		// 前后夹杂了说明文字时取第一个 { 到最后一个 } 之间的内容
+		start, end := strings.IndexByte(text, '{'), strings.LastIndexByte(text, '}')
+		if start >= 0 && end > start && (start > 0 || end < len(text)-1) {
+			if v, extractErr := decodeArguments(removeTrailingCommas(text[start : end+1])); extractErr == nil {
+				value, err = v, nil
+				repairs = append(repairs, "extracted the JSON object from surrounding text")
+			}
+		}
+	}
+	if err != nil {
+		return "", nil, &ArgumentError{
+			Problems: []ArgumentProblem{{Message: fmt.Sprintf("arguments are not valid JSON: %v", err)}},
+		}
+	}
+
+	r := &argumentRepairer{repairs: repairs}
+	value = r.repair(schema, value, "")
+	repaired, err := json.Marshal(value)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := validateSchema(schema, repaired); err != nil {
+		return "", nil, err
+	}
+	if len(r.repairs) == 0 {
+		return text, nil, nil
+	}
+	return string(repaired), r.repairs, nil
+}
+
+// validateSchema 用 jsonschema-go 校验参数，返回所有不符合 schema 的参数。
+// schema 本身无法解析时（例如 MCP 服务器提供了不支持的 schema）不做校验，交给工具自己处理
+func validateSchema(schema map[string]any, arguments []byte) error {
+	if schema == nil {
+		return nil
+	}
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return nil
+	}
+	var s jsonschema.Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil
+	}
+	// 只支持 draft-07 和 2020-12，其他版本的声明按 2020-12 处理
+	s.Schema = ""
+	if _, err := s.Resolve(nil); err != nil {
+		return nil
+	}
+
+	var instance any
+	if err := json.Unmarshal(arguments, &instance); err != nil {
+		return err
+	}
+	if problems := schemaProblems(&s, instance, ""); len(problems) > 0 {
+		return &ArgumentError{Problems: problems}
+	}
+	return nil
+}
+
+// validationPrefix jsonschema-go 在每一层错误前加上的 schema 位置
+var validationPrefix = regexp.MustCompile(`^(validating [^ ]+: )+`)
+
+// schemaProblems 收集 value 中所有不符合 schema 的位置。jsonschema-go 遇到第一个错误就返回，
+// 所以对象的属性和数组的元素逐个校验，再把子节点替换为空 schema 校验对象本身（类型、必填、多余的属性等）。
+// 使用 $ref 的 schema 或无法单独解析的子 schema 不再展开，整体报告一个问题
+func schemaProblems(schema *jsonschema.Schema, value any, path string) []ArgumentProblem {
+	ok, err := validateValue(schema, value)
+	if !ok || err == nil {
+		return nil
+	}
+
+	problems := make([]ArgumentProblem, 0)
+	shallow := *schema
+	switch v := value.(type) {
+	case map[string]any:
+		if schema.Ref != "" || len(schema.Properties) == 0 {
+			break
+		}
+		shallow.Properties = make(map[string]*jsonschema.Schema, len(schema.Properties))
+		for _, name := range slices.Sorted(maps.Keys(schema.Properties)) {
+			shallow.Properties[name] = &jsonschema.Schema{}
+			if propertyValue, ok := v[name]; ok {
+				problems = append(problems, schemaProblems(schema.Properties[name], propertyValue, propertyPath(path, name))...)
+			}
+		}
+	case []any:
+		if schema.Ref != "" || schema.Items == nil {
+			break
+		}
+		shallow.Items = &jsonschema.Schema{}
+		for i, item := range v {
+			problems = append(problems, schemaProblems(schema.Items, item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	if ok, shallowErr := validateValue(&shallow, value); ok && shallowErr != nil {
+		err = shallowErr
+	} else if len(problems) > 0 {
+		return problems
+	}
+	return append(problems, ArgumentProblem{Path: path, Message: validationPrefix.ReplaceAllString(err.Error(), "")})
+}
+
+// validateValue 用单独解析的 schema 校验 value，schema 无法解析时 ok 为 false
+func validateValue(schema *jsonschema.Schema, value any) (ok bool, err error) {
+	resolved, err := schema.Resolve(nil)
+	if err != nil {
+		return false, nil
+	}
+	return true, resolved.Validate(value)
+}
+
+func propertyPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func decodeArguments(text string) (any, error) {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("unexpected content after the JSON value")
+	}
+	return value, nil
+}
+
+// removeTrailingCommas 删除 } 和 ] 之前多余的逗号，忽略字符串中的内容
+func removeTrailingCommas(text string) string {
+	var b bytes.Buffer
+	inString, escaped := false, false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case inString:
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == ',':
+			j := i + 1
+			for j < len(text) && strings.IndexByte(" \t\r\n", text[j]) >= 0 {
+				j++
+			}
+			if j < len(text) && (text[j] == '}' || text[j] == ']') {
+				continue
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// argumentRepairer 按 schema 修复模型常见的类型错误，不判断参数是否合法，修复不了的值原样保留，由校验报告
+type argumentRepairer struct {
+	repairs []string
+}
+
+func (r *argumentRepairer) note(path, format string, args ...any) {
+	r.repairs = append(r.repairs, fmt.Sprintf("%s: %s", displayPath(path), fmt.Sprintf(format, args...)))
+}
+
+// repair 修复 value，返回修复后的值
+func (r *argumentRepairer) repair(schema map[string]any, value any, path string) any {
+	if schema == nil {
+		return value
+	}
+	types := schemaTypes(schema)
+	if len(types) > 0 && !slices.ContainsFunc(types, func(t string) bool { return matchesType(t, value) }) {
+		if coerced, ok := coerceValue(types, value); ok {
+			r.note(path, "converted %s to %s", describeValue(value), strings.Join(types, " or "))
+			value = coerced
+		}
+	}
+
+	switch value := value.(type) {
+	case []any:
+		items, _ := schema["items"].(map[string]any)
+		for i := range value {
+			value[i] = r.repair(items, value[i], fmt.Sprintf("%s[%d]", path, i))
+		}
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		required := schemaRequired(schema)
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			property, known := properties[name].(map[string]any)
+			if value[name] == nil && known && !slices.Contains(required, name) && !slices.Contains(schemaTypes(property), "null") {
+				// 可选参数传 null 视为未传入
+				delete(value, name)
+				r.note(joinPath(path, name), "removed null value of optional argument")
+				continue
+			}
+			if !known {
+				if additional, ok := schema["additionalProperties"].(map[string]any); ok {
+					value[name] = r.repair(additional, value[name], joinPath(path, name))
+				}
+				continue
+			}
+			value[name] = r.repair(property, value[name], joinPath(path, name))
+		}
+	}
+	return value
+}
+
+func schemaTypes(schema map[string]any) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []string:
+		return t
+	case []any:
+		types := make([]string, 0, len(t))
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func schemaRequired(schema map[string]any) []string {
+	switch required := schema["required"].(type) {
+	case []string:
+		return required
+	case []any:
+		names := make([]string, 0, len(required))
+		for _, item := range required {
+			if s, ok := item.(string); ok {
+				names = append(names, s)
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+func matchesType(t string, value any) bool {
+	switch t {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "integer":
+		// 1.0 这样带小数点或指数的整数需要改写，否则无法解析到 int 字段
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := strconv.ParseInt(n.String(), 10, 64)
+		return err == nil
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return true
+}
+
+// coerceValue 修复类型错误：字符串形式的数字、布尔值、对象和数组，数字形式的字符串，以及 1.0 形式的整数
+func coerceValue(types []string, value any) (any, bool) {
+	for _, t := range types {
+		switch value := value.(type) {
+		case string:
+			s := strings.TrimSpace(value)
+			switch t {
+			case "integer":
+				if n, ok := integerNumber(json.Number(s)); ok {
+					return n, true
+				}
+			case "number":
+				if _, err := strconv.ParseFloat(s, 64); err == nil {
+					return json.Number(s), true
+				}
+			case "boolean":
+				if b, err := strconv.ParseBool(s); err == nil {
+					return b, true
+				}
+			case "array", "object":
+				if parsed, err := decodeArguments(s); err == nil && matchesType(t, parsed) {
+					return parsed, true
+				}
+			}
+		case json.Number:
+			switch t {
+			case "integer":
+				if n, ok := integerNumber(value); ok {
+					return n, true
+				}
+			case "string":
+				return value.String(), true
+			}
+		case bool:
+			if t == "string" {
+				return strconv.FormatBool(value), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// integerNumber 把值为整数的数字改写为整数形式，例如 1.0 和 1e3
+func integerNumber(n json.Number) (json.Number, bool) {
+	f, err := strconv.ParseFloat(n.String(), 64)
+	if err != nil || f != math.Trunc(f) || math.Abs(f) > 1<<53 {
+		return "", false
+	}
+	return json.Number(strconv.FormatInt(int64(f), 10)), true
+}
+
+func describeValue(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		s := []rune(value)
+		if len(s) > 40 {
+			return strconv.Quote(string(s[:40])+"...") + " (string)"
+		}
+		return strconv.Quote(value) + " (string)"
+	case json.Number:
+		return value.String() + " (number)"
+	case bool:
+		return strconv.FormatBool(value) + " (boolean)"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "arguments"
+	}
+	return path
+}
@@ -0,0 +1,172 @@
+package tool
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateArguments(t *testing.T) {
+	tests := []struct {
+		name      string
+		schema    map[string]any
+		arguments string
+		want      string
+		repairs   []string
+		err       string // 错误信息中应包含的内容
+	}{
+		{
+			name:      "valid arguments are returned as is",
+			schema:    grepToolParameters,
+			arguments: `{"pattern": "foo", "limit": 5}`,
+			want:      `{"pattern": "foo", "limit": 5}`,
+		},
+		{
+			name:      "code fence and trailing comma",
+			schema:    grepToolParameters,
+			arguments: "```json\n{\"pattern\": \"foo\",}\n```",
+			want:      `{"pattern":"foo"}`,
+			repairs:   []string{"removed code fence", "removed trailing commas"},
+		},
+		{
+			name:      "surrounding text",
+			schema:    grepToolParameters,
+			arguments: `here you go: {"pattern": "foo"} done`,
+			want:      `{"pattern":"foo"}`,
+			repairs:   []string{"extracted the JSON object from surrounding text"},
+		},
+		{
+			name:      "integral float for an integer",
+			schema:    grepToolParameters,
+			arguments: `{"pattern": "foo", "limit": 1.0, "context": 2e1}`,
+			want:      `{"context":20,"limit":1,"pattern":"foo"}`,
+			repairs:   []string{"context: converted 2e1 (number) to integer", "limit: converted 1.0 (number) to integer"},
+		},
+		{
+			name:      "strings for numbers and booleans",
+			schema:    grepToolParameters,
+			arguments: `{"pattern": "foo", "limit": "10", "case_insensitive": "true"}`,
+			want:      `{"case_insensitive":true,"limit":10,"pattern":"foo"}`,
+			repairs:   []string{`case_insensitive: converted "true" (string) to boolean`, `limit: converted "10" (string) to integer`},
+		},
+		{
+			name:      "null optional argument",
+			schema:    grepToolParameters,
+			arguments: `{"pattern": "foo", "glob": null}`,
+			want:      `{"pattern":"foo"}`,
+			repairs:   []string{"glob: removed null value of optional argument"},
+		},
+		{
+			name:      "nested array as a string",
+			schema:    todoWriteToolParameters,
+			arguments: `{"todos": "[{\"content\": \"a\", \"status\": \"pending\"}]"}`,
+			want:      `{"todos":[{"content":"a","status":"pending"}]}`,
+			repairs:   []string{`todos: converted "[{\"content\": \"a\", \"status\": \"pending\"}]" (string) to null or array`},
+		},
+		{
+			name:      "fractional number for an integer",
+			schema:    grepToolParameters,
+			arguments: `{"pattern": "foo", "limit": 1.5}`,
+			err:       `has type "number", want "integer"`,
+		},
+		{
+			name:      "missing required argument",
+			schema:    grepToolParameters,
+			arguments: `{"path": "."}`,
+			err:       `missing properties: ["pattern"]`,
+		},
+		{
+			name:      "unknown argument",
+			schema:    grepToolParameters,
+			arguments: `{"pattern": "foo", "recursive": true}`,
+			err:       "recursive",
+		},
+		{
+			name:      "value not in enum",
+			schema:    todoWriteToolParameters,
+			arguments: `{"todos": [{"content": "a", "status": "started"}]}`,
+			err:       "started",
+		},
+		{
+			name:      "invalid JSON",
+			schema:    grepToolParameters,
+			arguments: `{"pattern": `,
+			err:       "arguments are not valid JSON",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, repairs, err := ValidateArguments(tt.schema, tt.arguments)
+			if tt.err != "" {
+				var argumentErr *ArgumentError
+				if !errors.As(err, &argumentErr) || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want an *ArgumentError containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("arguments:\ngot  %s\nwant %s", got, tt.want)
+			}
+			if !slices.Equal(repairs, tt.repairs) {
+				t.Errorf("repairs:\ngot  %q\nwant %q", repairs, tt.repairs)
+			}
+		})
+	}
+}
+
+func TestValidateArgumentsIntegerUnmarshal(t *testing.T) {
+	arguments, _, err := ValidateArguments(globToolParameters, `{"pattern": "*.go", "limit": 3.0}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p GlobToolParam
+	if err := json.Unmarshal([]byte(arguments), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Limit != 3 {
+		t.Errorf("limit: got %d, want 3", p.Limit)
+	}
+}
+
+func TestValidateArgumentsReportsEveryProblem(t *testing.T) {
+	tests := []struct {
+		name      string
+		schema    map[string]any
+		arguments string
+		paths     []string
+	}{
+		{
+			name:      "several invalid fields",
+			schema:    grepToolParameters,
+			arguments: `{"pattern": ["foo"], "limit": "many", "output_mode": "lines", "recursive": true}`,
+			paths:     []string{"limit", "output_mode", "pattern", ""},
+		},
+		{
+			name:      "nested array items",
+			schema:    todoWriteToolParameters,
+			arguments: `{"todos": [{"content": "a", "status": "pending"}, {"content": "b", "status": "started"}, {"status": "finished"}]}`,
+			paths:     []string{"todos[1].status", "todos[2].status", "todos[2]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ValidateArguments(tt.schema, tt.arguments)
+			var argumentErr *ArgumentError
+			if !errors.As(err, &argumentErr) {
+				t.Fatalf("got error %v, want an *ArgumentError", err)
+			}
+			paths := make([]string, 0, len(argumentErr.Problems))
+			for _, problem := range argumentErr.Problems {
+				paths = append(paths, problem.Path)
+			}
+			if !slices.Equal(paths, tt.paths) {
+				t.Errorf("problem paths:\ngot  %q\nwant %q\n%v", paths, tt.paths, err)
+			}
+		})
+	}
+}
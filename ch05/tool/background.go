@@ -0,0 +1,443 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/openai/openai-go/v3"
+	shared2 "github.com/openai/openai-go/v3/shared"
+
+	"babyagent/shared"
+)
+
+const (
+	// maxBackgroundProcesses 同时运行的后台进程数上限
+	maxBackgroundProcesses = 16
+	// maxBackgroundBufferBytes 每个后台进程在内存中保留的输出字节数，超出时丢弃最早的输出
+	maxBackgroundBufferBytes = 1024 * 1024
+	// maxBackgroundReadBytes 单次读取返回的输出字节数上限
+	maxBackgroundReadBytes = 16 * 1024
+	// maxBackgroundWait 读取输出时最多等待的时间
+	maxBackgroundWait = 30 * time.Second
+)
+
+// backgroundProcess 一个后台运行的命令，合并保存 stdout 和 stderr
+type backgroundProcess struct {
+	id        string
+	command   string
+	cmd       *exec.Cmd
+	startedAt time.Time
+	done      chan struct{} // 进程退出后关闭
+
+	mu       sync.Mutex
+	output   []byte
+	base     int64         // output[0] 在全部输出中的偏移，之前的输出已被丢弃
+	read     int64         // 已经返回给模型的输出偏移
+	notify   chan struct{} // 有新输出时关闭并替换
+	exitCode int
+	killed   bool
+	endedAt  time.Time
+}
+
+// Write 实现 io.Writer，作为进程的 stdout 和 stderr
+func (p *backgroundProcess) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.output = append(p.output, b...)
+	if over := len(p.output) - maxBackgroundBufferBytes; over > 0 {
+		p.output = append(p.output[:0], p.output[over:]...)
+		p.base += int64(over)
+	}
+	close(p.notify)
+	p.notify = make(chan struct{})
+	return len(b), nil
+}
+
+func (p *backgroundProcess) running() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// status 描述进程当前的状态，调用方需持有锁
+func (p *backgroundProcess) status() string {
+	switch {
+	case p.running():
+		return fmt.Sprintf("running for %s", time.Since(p.startedAt).Round(time.Second))
+	case p.killed:
+		return "killed"
+	default:
+		return fmt.Sprintf("exited with code %d after %s", p.exitCode, p.endedAt.Sub(p.startedAt).Round(time.Second))
+	}
+}
+
+// ProcessManager 管理会话中启动的后台进程，会话重置或 agent 退出时终止所有进程
+type ProcessManager struct {
+	mu        sync.Mutex
+	paths     *shared.PathPolicy // 限制进程的工作目录
+	processes map[string]*backgroundProcess
+	nextID    int
+}
+
+func NewProcessManager(paths *shared.PathPolicy) *ProcessManager {
+	return &ProcessManager{paths: paths, processes: make(map[string]*backgroundProcess)}
+}
+
+// Start 在后台启动命令，返回进程 id 和 pid。workdir 为空时使用工作区根目录，不在可读写目录中时拒绝启动
+func (m *ProcessManager) Start(command string, workdir string) (string, int, error) {
+	dir, err := resolveWorkdir(m.paths, workdir)
+	if err != nil {
+		return "", 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	running := 0
+	for _, p := range m.processes {
+		if p.running() {
+			running++
+		}
+	}
+	if running >= maxBackgroundProcesses {
+		return "", 0, fmt.Errorf("too many background processes (%d running), kill some of them first", running)
+	}
+
+	m.nextID++
+	p := &backgroundProcess{
+		id:        fmt.Sprintf("bg-%d", m.nextID),
+		command:   command,
+		startedAt: time.Now(),
+		done:      make(chan struct{}),
+		notify:    make(chan struct{}),
+	}
+	p.cmd = newShellCommand(context.Background(), command)
+	p.cmd.Dir = dir
+	p.cmd.Stdout = p
+	p.cmd.Stderr = p
+	if err := p.cmd.Start(); err != nil {
+		return "", 0, err
+	}
+	go func() {
+		err := p.cmd.Wait()
+		p.mu.Lock()
+		p.exitCode = p.cmd.ProcessState.ExitCode()
+		var exitErr *exec.ExitError
+		if err != nil && !errors.As(err, &exitErr) && !errors.Is(err, exec.ErrWaitDelay) {
+			p.output = fmt.Appendf(p.output, "\n[wait error: %v]\n", err)
+		}
+		p.endedAt = time.Now()
+		p.mu.Unlock()
+		close(p.done)
+	}()
+
+	m.processes[p.id] = p
+	return p.id, p.cmd.Process.Pid, nil
+}
+
+func (m *ProcessManager) get(id string) (*backgroundProcess, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.processes[id]
+	if !ok {
+		return nil, fmt.Errorf("background process %q not found", id)
+	}
+	return p, nil
+}
+
+// Read 返回上次读取之后的新输出。没有新输出且进程仍在运行时，最多等待 wait
+func (m *ProcessManager) Read(ctx context.Context, id string, wait time.Duration) (string, error) {
+	p, err := m.get(id)
+	if err != nil {
+		return "", err
+	}
+
+	p.mu.Lock()
+	notify := p.notify
+	pending := p.base+int64(len(p.output)) > p.read
+	p.mu.Unlock()
+	if !pending && wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-notify:
+		case <-p.done:
+		case <-timer.C:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var b strings.Builder
+	if p.read < p.base {
+		fmt.Fprintf(&b, "[... %d bytes of earlier output were dropped ...]\n", p.base-p.read)
+		p.read = p.base
+	}
+	chunk := p.output[p.read-p.base:]
+	if len(chunk) > maxBackgroundReadBytes {
+		chunk = chunk[:prefixLen(string(chunk), maxBackgroundReadBytes)]
+	}
+	b.Write(chunk)
+	p.read += int64(len(chunk))
+	if len(chunk) > 0 && !strings.HasSuffix(b.String(), "\n") {
+		b.WriteString("\n")
+	}
+
+	remaining := p.base + int64(len(p.output)) - p.read
+	if remaining > 0 {
+		fmt.Fprintf(&b, "[%s: %s, %d more bytes of output, read again to continue]", p.id, p.status(), remaining)
+	} else if len(chunk) == 0 {
+		fmt.Fprintf(&b, "[%s: %s, no new output]", p.id, p.status())
+	} else {
+		fmt.Fprintf(&b, "[%s: %s]", p.id, p.status())
+	}
+	return b.String(), nil
+}
+
+// Status 返回所有后台进程的状态，按启动顺序排列
+func (m *ProcessManager) Status() string {
+	m.mu.Lock()
+	processes := make([]*backgroundProcess, 0, len(m.processes))
+	for _, p := range m.processes {
+		processes = append(processes, p)
+	}
+	m.mu.Unlock()
+	if len(processes) == 0 {
+		return "no background processes"
+	}
+	sort.Slice(processes, func(i, j int) bool {
+		return processes[i].startedAt.Before(processes[j].startedAt)
+	})
+
+	var b strings.Builder
+	for _, p := range processes {
+		p.mu.Lock()
+		unread := p.base + int64(len(p.output)) - p.read
+		fmt.Fprintf(&b, "%s  pid %d  %s  %d bytes unread  $ %s\n", p.id, p.cmd.Process.Pid, p.status(), unread, p.command)
+		p.mu.Unlock()
+	}
+	return b.String()
+}
+
+// Kill 终止后台进程及其子进程
+func (m *ProcessManager) Kill(id string) (string, error) {
+	p, err := m.get(id)
+	if err != nil {
+		return "", err
+	}
+	if !p.running() {
+		// 直接子进程已经退出，但它启动的后台进程可能仍在进程组中运行
+		_ = killProcessGroup(p.cmd)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return fmt.Sprintf("[%s: already %s]", p.id, p.status()), nil
+	}
+
+	p.mu.Lock()
+	p.killed = true
+	p.mu.Unlock()
+	if err := killProcessGroup(p.cmd); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return "", err
+	}
+	select {
+	case <-p.done:
+	case <-time.After(killWaitDelay * 2):
+	}
+	return fmt.Sprintf("[%s: killed]", p.id), nil
+}
+
+// Close 终止所有后台进程并清空列表
+func (m *ProcessManager) Close() error {
+	m.mu.Lock()
+	processes := m.processes
+	m.processes = make(map[string]*backgroundProcess)
+	m.mu.Unlock()
+
+	errs := make([]error, 0)
+	for _, p := range processes {
+		if !p.running() {
+			// 直接子进程已经退出，它启动的后台进程仍可能留在进程组中，同样要终止
+			_ = killProcessGroup(p.cmd)
+			continue
+		}
+		if err := killProcessGroup(p.cmd); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			errs = append(errs, fmt.Errorf("failed to kill %s: %w", p.id, err))
+			continue
+		}
+		<-p.done
+	}
+	return errors.Join(errs...)
+}
+
+// BackgroundStartTool 在后台启动命令，立即返回进程 id
+type BackgroundStartTool struct {
+	manager *ProcessManager
+}
+
+func NewBackgroundStartTool(manager *ProcessManager) *BackgroundStartTool {
+	return &BackgroundStartTool{manager: manager}
+}
+
+type BackgroundStartToolParam struct {
+	Command string `json:"command" jsonschema:"the shell command to run"`
+	Workdir string `json:"workdir,omitempty" jsonschema:"the working directory, must be inside the workspace or a writable directory, defaults to the workspace root"`
+}
+
+var backgroundStartToolParameters = mustParametersFor[BackgroundStartToolParam]()
+
+func (t *BackgroundStartTool) ToolName() AgentTool {
+	return AgentToolBackgroundStart
+}
+
+func (t *BackgroundStartTool) Info() openai.ChatCompletionToolUnionParam {
+	return openai.ChatCompletionFunctionTool(shared2.FunctionDefinitionParam{
+		Name: AgentToolBackgroundStart,
+		Description: openai.String("start a long running command (dev server, watcher, long test run) in the background and return its id immediately. " +
+			"Use " + AgentToolBackgroundOutput + " to read its output, " + AgentToolBackgroundStatus + " to check it and " + AgentToolBackgroundKill + " to stop it. " +
+			"Background processes are killed when the session ends"),
+		Parameters: backgroundStartToolParameters,
+	})
+}
+
+func (t *BackgroundStartTool) Execute(ctx context.Context, argumentsInJSON string) (string, error) {
+	p := BackgroundStartToolParam{}
+	err := json.Unmarshal([]byte(argumentsInJSON), &p)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(p.Command) == "" {
+		return "", errors.New("command must not be empty")
+	}
+
+	id, pid, err := t.manager.Start(p.Command, p.Workdir)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("started %s (pid %d)", id, pid), nil
+}
+
+// BackgroundOutputTool 读取后台进程的新输出
+type BackgroundOutputTool struct {
+	manager *ProcessManager
+}
+
+func NewBackgroundOutputTool(manager *ProcessManager) *BackgroundOutputTool {
+	return &BackgroundOutputTool{manager: manager}
+}
+
+type BackgroundOutputToolParam struct {
+	ID   string `json:"id" jsonschema:"the background process id, e.g. bg-1"`
+	Wait int    `json:"wait,omitempty"`
+}
+
+var backgroundOutputToolParameters = mustParametersFor[BackgroundOutputToolParam](func(s *jsonschema.Schema) {
+	s.Properties["wait"].Description = fmt.Sprintf("seconds to wait for new output when there is none yet, at most %d, defaults to 0", int(maxBackgroundWait.Seconds()))
+})
+
+func (t *BackgroundOutputTool) ToolName() AgentTool {
+	return AgentToolBackgroundOutput
+}
+
+func (t *BackgroundOutputTool) Info() openai.ChatCompletionToolUnionParam {
+	return openai.ChatCompletionFunctionTool(shared2.FunctionDefinitionParam{
+		Name:        AgentToolBackgroundOutput,
+		Description: openai.String("read the output a background process produced since the last read, followed by its status"),
+		Parameters:  backgroundOutputToolParameters,
+	})
+}
+
+func (t *BackgroundOutputTool) Execute(ctx context.Context, argumentsInJSON string) (string, error) {
+	p := BackgroundOutputToolParam{}
+	err := json.Unmarshal([]byte(argumentsInJSON), &p)
+	if err != nil {
+		return "", err
+	}
+	wait := min(time.Duration(max(p.Wait, 0))*time.Second, maxBackgroundWait)
+	return t.manager.Read(ctx, p.ID, wait)
+}
+
+// BackgroundStatusTool 列出所有后台进程的状态
+type BackgroundStatusTool struct {
+	manager *ProcessManager
+}
+
+func NewBackgroundStatusTool(manager *ProcessManager) *BackgroundStatusTool {
+	return &BackgroundStatusTool{manager: manager}
+}
+
+type BackgroundStatusToolParam struct{}
+
+var backgroundStatusToolParameters = mustParametersFor[BackgroundStatusToolParam]()
+
+func (t *BackgroundStatusTool) ToolName() AgentTool {
+	return AgentToolBackgroundStatus
+}
+
+func (t *BackgroundStatusTool) ConcurrencySafe(string) bool {
+	return true
+}
+
+func (t *BackgroundStatusTool) Info() openai.ChatCompletionToolUnionParam {
+	return openai.ChatCompletionFunctionTool(shared2.FunctionDefinitionParam{
+		Name:        AgentToolBackgroundStatus,
+		Description: openai.String("list the background processes of this session with their status and the number of unread output bytes"),
+		Parameters:  backgroundStatusToolParameters,
+	})
+}
+
+func (t *BackgroundStatusTool) Execute(ctx context.Context, argumentsInJSON string) (string, error) {
+	return t.manager.Status(), nil
+}
+
+// BackgroundKillTool 终止后台进程
+type BackgroundKillTool struct {
+	manager *ProcessManager
+}
+
+func NewBackgroundKillTool(manager *ProcessManager) *BackgroundKillTool {
+	return &BackgroundKillTool{manager: manager}
+}
+
+type BackgroundKillToolParam struct {
+	ID string `json:"id" jsonschema:"the background process id, e.g. bg-1"`
+}
+
+var backgroundKillToolParameters = mustParametersFor[BackgroundKillToolParam]()
+
+func (t *BackgroundKillTool) ToolName() AgentTool {
+	return AgentToolBackgroundKill
+}
+
+func (t *BackgroundKillTool) Info() openai.ChatCompletionToolUnionParam {
+	return openai.ChatCompletionFunctionTool(shared2.FunctionDefinitionParam{
+		Name:        AgentToolBackgroundKill,
+		Description: openai.String("kill a background process together with all its child processes"),
+		Parameters:  backgroundKillToolParameters,
+	})
+}
+
+func (t *BackgroundKillTool) Execute(ctx context.Context, argumentsInJSON string) (string, error) {
+	p := BackgroundKillToolParam{}
+	err := json.Unmarshal([]byte(argumentsInJSON), &p)
+	if err != nil {
+		return "", err
+	}
+	return t.manager.Kill(p.ID)
+}
@@ -0,0 +1,129 @@
+package tool
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"babyagent/shared"
+)
+
+// processAlive 通过 /proc 判断进程是否仍在运行，僵尸进程视为已退出
+func processAlive(t *testing.T, pid int) bool {
+	t.Helper()
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+func TestProcessManagerCloseKillsOrphans(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("checks processes through /proc")
+	}
+	m := NewProcessManager(nil)
+	defer m.Close()
+
+	// sh 启动 sleep 后立即退出，sleep 继续持有输出管道
+	id, _, err := m.Start("sleep 30 & echo $!", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := m.get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-p.done:
+	case <-time.After(killWaitDelay * 3):
+		t.Fatal("sh did not exit")
+	}
+	output, err := m.Read(context.Background(), id, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.SplitN(output, "\n", 2)[0])
+	if err != nil {
+		t.Fatalf("unexpected output %q", output)
+	}
+	if !processAlive(t, pid) {
+		t.Fatalf("sleep %d exited before Close", pid)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(killWaitDelay)
+	for processAlive(t, pid) {
+		if time.Now().After(deadline) {
+			t.Fatalf("sleep %d is still running after Close", pid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestProcessManagerWorkdir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses pwd")
+	}
+	root := t.TempDir()
+	readOnly := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	paths, err := shared.NewPathPolicy(root, []string{readOnly}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewProcessManager(paths)
+	defer m.Close()
+
+	tests := []struct {
+		workdir string
+		want    string // 为空表示应当拒绝启动
+	}{
+		{workdir: "", want: paths.Root()},
+		{workdir: "sub", want: filepath.Join(paths.Root(), "sub")},
+		{workdir: outside},
+		{workdir: "../"},
+		{workdir: "link"},
+		{workdir: readOnly},
+		{workdir: "missing"},
+	}
+	for _, tt := range tests {
+		id, _, err := m.Start("pwd -P", tt.workdir)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("workdir %q: started %s, want an error", tt.workdir, id)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("workdir %q: %v", tt.workdir, err)
+			continue
+		}
+		p, err := m.get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		<-p.done
+		output, err := m.Read(context.Background(), id, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.SplitN(output, "\n", 2)[0]; got != tt.want {
+			t.Errorf("workdir %q: ran in %q, want %q", tt.workdir, got, tt.want)
+		}
+	}
+}
@@ -1,65 +1,167 @@
 package tool
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
 	"os/exec"
-	"runtime"
+	"strings"
+	"time"
 
+	"github.com/google/jsonschema-go/jsonschema"
 	"github.com/openai/openai-go/v3"
-	"github.com/openai/openai-go/v3/shared"
+	shared2 "github.com/openai/openai-go/v3/shared"
+
+	"babyagent/shared"
+)
+
+const (
+	// defaultBashTimeout 未指定 timeout 时命令的最长运行时间
+	defaultBashTimeout = 2 * time.Minute
+	// maxBashTimeout timeout 参数的上限
+	maxBashTimeout = 10 * time.Minute
+	// killWaitDelay 进程被终止后等待输出管道关闭的最长时间，避免后台子进程占用管道导致一直阻塞
+	killWaitDelay = 2 * time.Second
 )
 
-type BashTool struct{}
+// BashTool 执行单条命令。命令从工作区根目录开始执行
+type BashTool struct {
+	paths *shared.PathPolicy
+}
 
-func NewBashTool() *BashTool {
-	return &BashTool{}
+func NewBashTool(paths *shared.PathPolicy) *BashTool {
+	return &BashTool{paths: paths}
 }
 
 type BashToolParam struct {
-	Command string `json:"command"`
+	Command string `json:"command" jsonschema:"the bash command to execute"`
+	Timeout int    `json:"timeout,omitempty"`
 }
 
+var bashToolParameters = mustParametersFor[BashToolParam](func(s *jsonschema.Schema) {
+	s.Properties["timeout"].Description = fmt.Sprintf("timeout in seconds, the command and all its child processes are killed when it expires, defaults to %d, at most %d",
+		int(defaultBashTimeout.Seconds()), int(maxBashTimeout.Seconds()))
+})
+
 func (t *BashTool) ToolName() AgentTool {
 	return AgentToolBash
 }
 
+// OutputPolicy 命令输出中报错信息和测试结果通常在结尾，结尾保留得更多
+func (t *BashTool) OutputPolicy() OutputPolicy {
+	return OutputPolicy{MaxBytes: 24 * 1024, MaxLines: 400, HeadPercent: 30}
+}
+
 func (t *BashTool) Info() openai.ChatCompletionToolUnionParam {
-	return openai.ChatCompletionFunctionTool(shared.FunctionDefinitionParam{
+	return openai.ChatCompletionFunctionTool(shared2.FunctionDefinitionParam{
 		Name:        string(AgentToolBash),
-		Description: openai.String("execute bash command"),
-		Parameters: openai.FunctionParameters{
-			"type": "object",
-			"properties": map[string]any{
-				"command": map[string]any{
-					"type":        "string",
-					"description": "the bash command to execute",
-				},
-			},
-			"required": []string{"command"},
-		},
+		Description: openai.String("execute bash command, returns the combined stdout and stderr followed by the exit code"),
+		Parameters:  bashToolParameters,
 	})
 }
 
 func (t *BashTool) Execute(ctx context.Context, argumentsInJSON string) (string, error) {
+	result, err := t.ExecuteResult(ctx, argumentsInJSON)
+	if err != nil {
+		return "", err
+	}
+	return result.Output()
+}
+
+// ExecuteResult 执行命令，退出码和是否超时记录在结果的元数据中
+func (t *BashTool) ExecuteResult(ctx context.Context, argumentsInJSON string) (ToolResult, error) {
 	p := BashToolParam{}
 	err := json.Unmarshal([]byte(argumentsInJSON), &p)
 	if err != nil {
-		return "", err
+		return ToolResult{}, err
+	}
+
+	timeout := defaultBashTimeout
+	if p.Timeout > 0 {
+		timeout = min(time.Duration(p.Timeout)*time.Second, maxBashTimeout)
+	}
+	workdir, err := resolveWorkdir(t.paths, "")
+	if err != nil {
+		return ToolResult{}, err
+	}
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := newShellCommand(runCtx, p.Command)
+	cmd.Dir = workdir
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err = cmd.Run()
+
+	// 整轮对话被取消时直接返回错误
+	if ctx.Err() != nil {
+		return ToolResult{}, ctx.Err()
 	}
 
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		// Windows: use cmd.exe to interpret the command line
-		cmd = exec.CommandContext(ctx, "cmd", "/C", p.Command)
-	} else {
-		// Linux/macOS: use POSIX sh (more universal than assuming bash exists)
-		cmd = exec.CommandContext(ctx, "sh", "-c", p.Command)
+	var b strings.Builder
+	b.WriteString(output.String())
+	if output.Len() > 0 && !bytes.HasSuffix(output.Bytes(), []byte("\n")) {
+		b.WriteString("\n")
+	}
+	var exitErr *exec.ExitError
+	metadata := make(map[string]any)
+	switch {
+	case errors.Is(runCtx.Err(), context.DeadlineExceeded):
+		fmt.Fprintf(&b, "[killed: command timed out after %s]", timeout)
+		metadata["timed_out"] = true
+	case err == nil:
+		b.WriteString("[exit code: 0]")
+		metadata["exit_code"] = 0
+	case errors.As(err, &exitErr):
+		fmt.Fprintf(&b, "[exit code: %d]", exitErr.ExitCode())
+		metadata["exit_code"] = exitErr.ExitCode()
+	case errors.Is(err, exec.ErrWaitDelay):
+		// 命令已退出，但它启动的后台进程仍占用输出管道，终止这些进程
+		_ = killProcessGroup(cmd)
+		fmt.Fprintf(&b, "[exit code: %d, background processes holding the output open were killed]", cmd.ProcessState.ExitCode())
+		metadata["exit_code"] = cmd.ProcessState.ExitCode()
+	default:
+		return ToolResult{}, err
 	}
+	result := TextResult(b.String())
+	result.Metadata = metadata
+	return result, nil
+}
 
-	output, err := cmd.CombinedOutput()
+// resolveWorkdir 解析命令的工作目录，dir 为空时使用工作区根目录。
+// 命令可以修改工作目录中的文件，所以目录必须位于可读写的目录中；paths 为 nil 时不做限制，空的 dir 表示当前目录
+func resolveWorkdir(paths *shared.PathPolicy, dir string) (string, error) {
+	if dir == "" {
+		if paths == nil {
+			return "", nil
+		}
+		dir = paths.Root()
+	}
+	resolved, err := paths.Resolve(dir, shared.PathWrite)
 	if err != nil {
 		return "", err
 	}
-	return string(output), nil
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+	return resolved, nil
+}
+
+// newShellCommand 创建在独立进程组中运行的命令，ctx 结束时终止整个进程组
+func newShellCommand(ctx context.Context, command string) *exec.Cmd {
+	cmd := shellCommand(ctx, command)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd)
+	}
+	cmd.WaitDelay = killWaitDelay
+	return cmd
 }
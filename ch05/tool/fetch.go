@@ -0,0 +1,270 @@
+package tool
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/shared"
+)
+
+// FetchPolicy 限制 fetch 工具可以访问的地址和读取的数据量
+type FetchPolicy struct {
+	// AllowedHosts 允许访问的主机，支持 *.example.com 匹配子域名，可以带端口。为空时不限制
+	AllowedHosts []string
+	// MaxBytes 最多读取的响应体字节数，超出部分丢弃
+	MaxBytes int64
+	// Timeout 单次请求（包括重定向和读取响应体）的最长时间
+	Timeout time.Duration
+	// MaxRedirects 最多跟随的重定向次数，0 表示不跟随
+	MaxRedirects int
+}
+
+var DefaultFetchPolicy = FetchPolicy{
+	MaxBytes:     5 * 1024 * 1024,
+	Timeout:      30 * time.Second,
+	MaxRedirects: 5,
+}
+
+// FetchTool 发送 HTTP 请求，HTML 转换为 Markdown，JSON 格式化后返回
+type FetchTool struct {
+	client *http.Client
+	policy FetchPolicy
+}
+
+// NewFetchTool client 为 nil 时使用 http.DefaultClient，测试时可以传入 httptest.Server 的 Client
+func NewFetchTool(client *http.Client, policy FetchPolicy) *FetchTool {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &FetchTool{client: client, policy: policy}
+}
+
+type FetchToolParam struct {
+	URL            string            `json:"url" jsonschema:"the http or https URL"`
+	Method         string            `json:"method,omitempty" jsonschema:"the HTTP method, defaults to GET"`
+	Headers        map[string]string `json:"headers,omitempty" jsonschema:"request headers"`
+	Body           string            `json:"body,omitempty" jsonschema:"request body, Content-Type defaults to application/json when the body is valid JSON"`
+	Raw            bool              `json:"raw,omitempty" jsonschema:"return the response body as is, without converting HTML or formatting JSON"`
+	IncludeHeaders bool              `json:"include_headers,omitempty" jsonschema:"include all response headers in the result"`
+}
+
+var fetchToolParameters = mustParametersFor[FetchToolParam]()
+
+func (t *FetchTool) ToolName() AgentTool {
+	return AgentToolFetch
+}
+
+// ConcurrencySafe 只有 GET 和 HEAD 请求可以并发，其他方法可能修改服务端状态，需要按顺序执行
+func (t *FetchTool) ConcurrencySafe(argumentsInJSON string) bool {
+	p := FetchToolParam{}
+	if err := json.Unmarshal([]byte(argumentsInJSON), &p); err != nil {
+		return false
+	}
+	switch strings.ToUpper(strings.TrimSpace(p.Method)) {
+	case "", http.MethodGet, http.MethodHead:
+		return true
+	}
+	return false
+}
+
+func (t *FetchTool) Info() openai.ChatCompletionToolUnionParam {
+	return openai.ChatCompletionFunctionTool(shared.FunctionDefinitionParam{
+		Name: AgentToolFetch,
+		Description: openai.String("send an HTTP request and return the status and response body. HTML pages are converted to Markdown and JSON is pretty printed, " +
+			"use it to read documentation and changelogs or to call HTTP APIs. Responses with an error status are returned as well"),
+		Parameters: fetchToolParameters,
+	})
+}
+
+func (t *FetchTool) Execute(ctx context.Context, argumentsInJSON string) (string, error) {
+	p := FetchToolParam{}
+	err := json.Unmarshal([]byte(argumentsInJSON), &p)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(strings.TrimSpace(p.URL))
+	if err != nil {
+		return "", fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported url scheme %q, only http and https are allowed", u.Scheme)
+	}
+	if err := t.checkHost(u); err != nil {
+		return "", err
+	}
+
+	method := strings.ToUpper(strings.TrimSpace(p.Method))
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	if t.policy.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.policy.Timeout)
+		defer cancel()
+	}
+
+	var body io.Reader
+	if p.Body != "" {
+		body = strings.NewReader(p.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range p.Headers {
+		req.Header.Set(k, v)
+	}
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", "babyagent-fetch/1.0")
+	}
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "text/markdown, text/html;q=0.9, application/json;q=0.9, */*;q=0.8")
+	}
+	if p.Body != "" && req.Header.Get("Content-Type") == "" && json.Valid([]byte(p.Body)) {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	// 复制一份 client，不修改调用方传入的 client
+	client := *t.client
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > t.policy.MaxRedirects {
+			return fmt.Errorf("stopped after %d redirects", t.policy.MaxRedirects)
+		}
+		return t.checkHost(req.URL)
+	}
+	if t.policy.MaxRedirects <= 0 {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return "", fmt.Errorf("request timed out after %s", t.policy.Timeout)
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	reader := io.Reader(resp.Body)
+	if t.policy.MaxBytes > 0 {
+		reader = io.LimitReader(resp.Body, t.policy.MaxBytes+1)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return "", fmt.Errorf("reading the response timed out after %s", t.policy.Timeout)
+		}
+		return "", err
+	}
+	truncated := t.policy.MaxBytes > 0 && int64(len(data)) > t.policy.MaxBytes
+	if truncated {
+		data = data[:t.policy.MaxBytes]
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s\n", resp.Proto, resp.Status)
+	if final := resp.Request.URL.String(); final != u.String() {
+		fmt.Fprintf(&b, "URL: %s\n", final)
+	}
+	if p.IncludeHeaders {
+		keys := make([]string, 0, len(resp.Header))
+		for k := range resp.Header {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&b, "%s: %s\n", k, strings.Join(resp.Header[k], ", "))
+		}
+	} else if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		fmt.Fprintf(&b, "Content-Type: %s\n", contentType)
+	}
+
+	content, title := formatResponseBody(data, resp.Header.Get("Content-Type"), resp.Request.URL, p.Raw, truncated)
+	if title != "" {
+		fmt.Fprintf(&b, "Title: %s\n", title)
+	}
+	if content != "" {
+		b.WriteString("\n")
+		b.WriteString(content)
+	}
+	if truncated {
+		fmt.Fprintf(&b, "\n[response truncated at %d bytes]", t.policy.MaxBytes)
+	}
+	return b.String(), nil
+}
+
+// checkHost 检查主机是否在允许列表中
+func (t *FetchTool) checkHost(u *url.URL) error {
+	if len(t.policy.AllowedHosts) == 0 {
+		return nil
+	}
+	host := strings.ToLower(u.Hostname())
+	hostWithPort := strings.ToLower(u.Host)
+	for _, allowed := range t.policy.AllowedHosts {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		target := host
+		if strings.Contains(allowed, ":") {
+			target = hostWithPort
+		}
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(target, "."+suffix) {
+				return nil
+			}
+			continue
+		}
+		if target == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("host %q is not in the allowed hosts: %s", u.Host, strings.Join(t.policy.AllowedHosts, ", "))
+}
+
+// formatResponseBody 根据 Content-Type 转换响应体，返回内容和 HTML 页面标题
+func formatResponseBody(data []byte, contentType string, base *url.URL, raw, truncated bool) (string, string) {
+	if len(data) == 0 {
+		return "", ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "" {
+		mediaType = http.DetectContentType(data)
+		mediaType, _, _ = mime.ParseMediaType(mediaType)
+	}
+
+	isJSON := mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+	isHTML := mediaType == "text/html" || mediaType == "application/xhtml+xml"
+	isText := strings.HasPrefix(mediaType, "text/") || isJSON || strings.HasSuffix(mediaType, "+xml") ||
+		mediaType == "application/xml" || mediaType == "application/javascript" || mediaType == "application/x-ndjson"
+	if !isText && (!utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0) {
+		return fmt.Sprintf("[binary content of type %s, %d bytes omitted]", mediaType, len(data)), ""
+	}
+
+	text := strings.ToValidUTF8(string(data), "�")
+	switch {
+	case raw:
+		return text, ""
+	case isHTML:
+		return htmlToMarkdown(text, base)
+	case isJSON && !truncated:
+		var out bytes.Buffer
+		if err := json.Indent(&out, data, "", "  "); err == nil {
+			return out.String(), ""
+		}
+	}
+	return text, ""
+}
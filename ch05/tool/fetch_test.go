@@ -0,0 +1,251 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newFetchTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/text", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"a":1,"b":[true]}`))
+	})
+	mux.HandleFunc("/html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<title>Doc</title><h1>Hi</h1><a href="/text">text</a>`))
+	})
+	mux.HandleFunc("/binary", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write([]byte{0, 1, 2, 3})
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+	})
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(r.Method + " " + r.Header.Get("Content-Type")))
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not here", http.StatusNotFound)
+	})
+	mux.HandleFunc("/redirect/{n}", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.PathValue("n"))
+		if n <= 0 {
+			http.Redirect(w, r, "/text", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "/redirect/"+strconv.Itoa(n-1), http.StatusFound)
+	})
+	mux.HandleFunc("/redirect-away", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, strings.Replace("http://"+r.Host+"/text", "127.0.0.1", "localhost", 1), http.StatusFound)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	mux.HandleFunc("/slow-body", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetchTool(t *testing.T) {
+	server := newFetchTestServer(t)
+	host := strings.TrimPrefix(server.URL, "http://")
+	policy := FetchPolicy{MaxBytes: 1024, Timeout: 5 * time.Second, MaxRedirects: 2}
+
+	tests := []struct {
+		name   string
+		policy FetchPolicy
+		param  FetchToolParam
+		want   string
+		err    string
+	}{
+		{
+			name:  "text",
+			param: FetchToolParam{URL: server.URL + "/text"},
+			want:  "HTTP/1.1 200 OK\nContent-Type: text/plain; charset=utf-8\n\nhello",
+		},
+		{
+			name:  "json is indented",
+			param: FetchToolParam{URL: server.URL + "/json"},
+			want:  "HTTP/1.1 200 OK\nContent-Type: application/json\n\n{\n  \"a\": 1,\n  \"b\": [\n    true\n  ]\n}",
+		},
+		{
+			name:  "raw json",
+			param: FetchToolParam{URL: server.URL + "/json", Raw: true},
+			want:  "HTTP/1.1 200 OK\nContent-Type: application/json\n\n{\"a\":1,\"b\":[true]}",
+		},
+		{
+			name:  "html is converted to markdown",
+			param: FetchToolParam{URL: server.URL + "/html"},
+			want:  "HTTP/1.1 200 OK\nContent-Type: text/html\nTitle: Doc\n\n# Hi\n\n[text](" + server.URL + "/text)",
+		},
+		{
+			name:  "binary",
+			param: FetchToolParam{URL: server.URL + "/binary"},
+			want:  "HTTP/1.1 200 OK\nContent-Type: application/octet-stream\n\n[binary content of type application/octet-stream, 4 bytes omitted]",
+		},
+		{
+			name:  "error status is returned",
+			param: FetchToolParam{URL: server.URL + "/missing"},
+			want:  "HTTP/1.1 404 Not Found\nContent-Type: text/plain; charset=utf-8\n\nnot here\n",
+		},
+		{
+			name:  "method and json body",
+			param: FetchToolParam{URL: server.URL + "/echo", Method: "post", Body: `{"a":1}`},
+			want:  "HTTP/1.1 200 OK\nContent-Type: text/plain\n\nPOST application/json",
+		},
+		{
+			name:   "byte limit",
+			policy: FetchPolicy{MaxBytes: 10, Timeout: 5 * time.Second},
+			param:  FetchToolParam{URL: server.URL + "/large"},
+			want:   "HTTP/1.1 200 OK\nContent-Type: text/plain\n\nxxxxxxxxxx\n[response truncated at 10 bytes]",
+		},
+		{
+			name:  "redirects are followed",
+			param: FetchToolParam{URL: server.URL + "/redirect/1"},
+			want:  "HTTP/1.1 200 OK\nURL: " + server.URL + "/text\nContent-Type: text/plain; charset=utf-8\n\nhello",
+		},
+		{
+			name:  "too many redirects",
+			param: FetchToolParam{URL: server.URL + "/redirect/2"},
+			err:   "stopped after 2 redirects",
+		},
+		{
+			name:   "redirects disabled",
+			policy: FetchPolicy{MaxBytes: 1024, Timeout: 5 * time.Second},
+			param:  FetchToolParam{URL: server.URL + "/redirect/0"},
+			want:   "HTTP/1.1 302 Found\nContent-Type: text/html; charset=utf-8\n\n[Found](" + server.URL + "/text).",
+		},
+		{
+			name:   "host allowed",
+			policy: FetchPolicy{AllowedHosts: []string{"127.0.0.1"}, MaxBytes: 1024, Timeout: 5 * time.Second},
+			param:  FetchToolParam{URL: server.URL + "/text"},
+			want:   "HTTP/1.1 200 OK\nContent-Type: text/plain; charset=utf-8\n\nhello",
+		},
+		{
+			name:   "host not allowed",
+			policy: FetchPolicy{AllowedHosts: []string{"example.com"}, MaxBytes: 1024, Timeout: 5 * time.Second},
+			param:  FetchToolParam{URL: server.URL + "/text"},
+			err:    `host "` + host + `" is not in the allowed hosts: example.com`,
+		},
+		{
+			name:   "redirect to a host that is not allowed",
+			policy: FetchPolicy{AllowedHosts: []string{host}, MaxBytes: 1024, Timeout: 5 * time.Second, MaxRedirects: 2},
+			param:  FetchToolParam{URL: server.URL + "/redirect-away"},
+			err:    `is not in the allowed hosts: ` + host,
+		},
+		{
+			name:  "unsupported scheme",
+			param: FetchToolParam{URL: "file:///etc/passwd"},
+			err:   `unsupported url scheme "file", only http and https are allowed`,
+		},
+		{
+			name:   "request timeout",
+			policy: FetchPolicy{MaxBytes: 1024, Timeout: 100 * time.Millisecond},
+			param:  FetchToolParam{URL: server.URL + "/slow"},
+			err:    "request timed out after 100ms",
+		},
+		{
+			name:   "read timeout",
+			policy: FetchPolicy{MaxBytes: 1024, Timeout: 100 * time.Millisecond},
+			param:  FetchToolParam{URL: server.URL + "/slow-body"},
+			err:    "reading the response timed out after 100ms",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.policy
+			if p.Timeout == 0 {
+				p = policy
+			}
+			args, _ := json.Marshal(tt.param)
+			got, err := NewFetchTool(server.Client(), p).Execute(context.Background(), string(args))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("\ngot  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchToolCheckHost(t *testing.T) {
+	tool := NewFetchTool(nil, FetchPolicy{AllowedHosts: []string{"example.com", "*.golang.org", "localhost:8080"}})
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://example.com/a", true},
+		{"https://EXAMPLE.com:443/a", true},
+		{"https://www.example.com/", false},
+		{"https://pkg.golang.org/", true},
+		{"https://a.b.golang.org/", true},
+		{"https://golang.org/", false},
+		{"https://evilgolang.org/", false},
+		{"http://localhost:8080/", true},
+		{"http://localhost:9090/", false},
+		{"http://localhost/", false},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tool.checkHost(u); (err == nil) != tt.allowed {
+			t.Errorf("checkHost(%s): got %v, want allowed %v", tt.url, err, tt.allowed)
+		}
+	}
+}
+
+func TestFetchToolConcurrencySafe(t *testing.T) {
+	tests := []struct {
+		arguments string
+		want      bool
+	}{
+		{arguments: `{"url":"https://example.com"}`, want: true},
+		{arguments: `{"url":"https://example.com","method":"get"}`, want: true},
+		{arguments: `{"url":"https://example.com","method":"HEAD"}`, want: true},
+		{arguments: `{"url":"https://example.com","method":"POST","body":"{}"}`, want: false},
+		{arguments: `{"url":"https://example.com","method":"DELETE"}`, want: false},
+		{arguments: `{"url":`, want: false},
+	}
+	fetch := NewFetchTool(nil, DefaultFetchPolicy)
+	for _, tt := range tests {
+		if got := fetch.ConcurrencySafe(tt.arguments); got != tt.want {
+			t.Errorf("ConcurrencySafe(%s) = %v, want %v", tt.arguments, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package tool
+
+import (
+	"bufio"
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreRule .gitignore 中的一条规则
+type ignoreRule struct {
+	base    string // .gitignore 所在目录，相对于遍历的根目录，使用 / 分隔
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreMatcher 从根目录到当前目录所有 .gitignore 中的规则，越靠后的规则优先级越高
+type ignoreMatcher struct {
+	rules []ignoreRule
+}
+
+// loadGitignore 读取 dir/.gitignore，返回追加了其中规则的新 matcher，文件不存在时返回原 matcher
+func (m *ignoreMatcher) loadGitignore(dir string, base string) *ignoreMatcher {
+	file, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return m
+	}
+	defer file.Close()
+
+	rules := append([]ignoreRule(nil), m.rules...)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(scanner.Text(), base); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return &ignoreMatcher{rules: rules}
+}
+
+func parseIgnoreRule(line string, base string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	// 除结尾外包含 / 的规则相对于 .gitignore 所在目录，否则匹配任意层级的文件名
+	prefix := "^(?:.*/)?"
+	if strings.Contains(line, "/") {
+		prefix = "^"
+		line = strings.TrimPrefix(line, "/")
+	}
+	re, err := regexp.Compile(prefix + globToRegexp(line) + "$")
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	rule.re = re
+	return rule, true
+}
+
+// ignored 判断相对于根目录的路径 rel 是否被忽略
+func (m *ignoreMatcher) ignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		target := rel
+		if rule.base != "" {
+			var ok bool
+			if target, ok = strings.CutPrefix(rel, rule.base+"/"); !ok {
+				continue
+			}
+		}
+		if rule.re.MatchString(target) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// walkFunc 遍历时对每个文件或目录的回调，rel 为相对于根目录、使用 / 分隔的路径。返回 fs.SkipDir 或 fs.SkipAll 的效果与 filepath.WalkDir 相同
+type walkFunc func(path string, rel string, d fs.DirEntry) error
+
+// walkWorkspace 遍历 root 下的文件，总是跳过 .git 目录，gitignore 为 true 时跳过 .gitignore 忽略的文件和目录。
+// root 位于工作区 workspace 之内时，先加载从 workspace 到 root 每一级目录中的 .gitignore，从子目录开始遍历时上层的规则同样生效。
+// maxDepth > 0 时不进入更深的目录
+func walkWorkspace(ctx context.Context, workspace string, root string, gitignore bool, maxDepth int, fn walkFunc) error {
+	matchers := map[string]*ignoreMatcher{}
+	prefix := "" // root 相对于 workspace 的路径，规则按相对于 workspace 的路径匹配
+	if gitignore {
+		matchers["."], prefix = loadParentGitignores(workspace, root)
+	}
+
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			// 无权限等错误不影响其他文件
+			if d != nil && d.IsDir() && p != root {
+				return fs.SkipDir
+			}
+			if p == root {
+				return err
+			}
+			return nil
+		}
+		if p == root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() && d.Name() == ".git" {
+			return fs.SkipDir
+		}
+		if gitignore {
+			matcher := matchers[path.Dir(rel)]
+			ruleRel := path.Join(prefix, rel)
+			if matcher.ignored(ruleRel, d.IsDir()) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				matchers[rel] = matcher.loadGitignore(p, ruleRel)
+			}
+		}
+
+		if err := fn(p, rel, d); err != nil {
+			return err
+		}
+		if d.IsDir() && maxDepth > 0 && strings.Count(rel, "/")+1 >= maxDepth {
+			return fs.SkipDir
+		}
+		return nil
+	})
+}
+
+// loadParentGitignores 加载从 workspace 到 root 每一级目录中的 .gitignore，返回 matcher 和 root 相对于 workspace 的路径。
+// root 不在 workspace 之内时只加载 root 中的 .gitignore，路径为空。
+// 遍历起点本身即使被上层规则忽略也照常遍历，与直接指定路径时 git 的行为一致
+func loadParentGitignores(workspace string, root string) (*ignoreMatcher, string) {
+	matcher := &ignoreMatcher{}
+	rel, err := filepath.Rel(workspace, root)
+	if workspace == "" || err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return matcher.loadGitignore(root, ""), ""
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == "." {
+		rel = ""
+	}
+
+	matcher = matcher.loadGitignore(workspace, "")
+	dir := ""
+	for _, name := range strings.Split(rel, "/") {
+		if name == "" {
+			continue
+		}
+		dir = path.Join(dir, name)
+		matcher = matcher.loadGitignore(filepath.Join(workspace, filepath.FromSlash(dir)), dir)
+	}
+	return matcher, rel
+}
+
+// globToRegexp 将 glob 转换为正则表达式（不含首尾锚点）。支持 * ? [...] {a,b}，以及跨目录的 **
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				atStart := i == 0 || glob[i-1] == '/'
+				i++
+				switch {
+				case atStart && i+1 < len(glob) && glob[i+1] == '/':
+					// **/ 匹配零个或多个目录
+					b.WriteString("(?:.*/)?")
+					i++
+				default:
+					b.WriteString(".*")
+				}
+				continue
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '{':
+			end := strings.IndexByte(glob[i+1:], '}')
+			if end < 0 {
+				b.WriteString(`\{`)
+				continue
+			}
+			alternatives := strings.Split(glob[i+1:i+1+end], ",")
+			for j, alternative := range alternatives {
+				alternatives[j] = globToRegexp(alternative)
+			}
+			b.WriteString("(?:" + strings.Join(alternatives, "|") + ")")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
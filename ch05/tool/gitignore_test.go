@@ -0,0 +1,207 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"babyagent/shared"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob    string
+		match   []string
+		noMatch []string
+	}{
+		{"*.go", []string{"main.go", ".go"}, []string{"dir/main.go", "main.go.bak"}},
+		{"**/*.go", []string{"main.go", "a/main.go", "a/b/c/main.go"}, []string{"main.txt", "a/main.go/x"}},
+		{"src/**/*.ts", []string{"src/a.ts", "src/x/y/a.ts"}, []string{"a.ts", "lib/src/a.ts"}},
+		{"src/**", []string{"src/a", "src/a/b"}, []string{"src", "other/a"}},
+		{"a/**/b", []string{"a/b", "a/x/b", "a/x/y/b"}, []string{"a/xb", "ab"}},
+		{"a**b", []string{"ab", "axxb", "ax/yb"}, []string{"a/c"}},
+		{"?.txt", []string{"a.txt"}, []string{"ab.txt", "/.txt"}},
+		{"[abc].md", []string{"a.md", "c.md"}, []string{"d.md"}},
+		{"[!abc].md", []string{"d.md"}, []string{"a.md"}},
+		{"*.{go,mod}", []string{"a.go", "go.mod"}, []string{"a.sum"}},
+		{`\*.txt`, []string{"*.txt"}, []string{"a.txt"}},
+		{"a.b", []string{"a.b"}, []string{"axb"}},
+	}
+	for _, tt := range tests {
+		re := regexp.MustCompile("^" + globToRegexp(tt.glob) + "$")
+		for _, s := range tt.match {
+			if !re.MatchString(s) {
+				t.Errorf("glob %q should match %q (regexp %s)", tt.glob, s, re)
+			}
+		}
+		for _, s := range tt.noMatch {
+			if re.MatchString(s) {
+				t.Errorf("glob %q should not match %q (regexp %s)", tt.glob, s, re)
+			}
+		}
+	}
+}
+
+func TestIgnoreMatcher(t *testing.T) {
+	parse := func(base string, lines ...string) []ignoreRule {
+		rules := make([]ignoreRule, 0)
+		for _, line := range lines {
+			if rule, ok := parseIgnoreRule(line, base); ok {
+				rules = append(rules, rule)
+			}
+		}
+		return rules
+	}
+	tests := []struct {
+		name    string
+		rules   []ignoreRule
+		rel     string
+		isDir   bool
+		ignored bool
+	}{
+		{"name matches at any depth", parse("", "*.log"), "a/b/x.log", false, true},
+		{"comment and blank lines", parse("", "# *.log", "", "   "), "x.log", false, false},
+		{"negation re-includes", parse("", "*.log", "!keep.log"), "keep.log", false, false},
+		{"negation only affects matches", parse("", "*.log", "!keep.log"), "other.log", false, true},
+		{"later rule wins", parse("", "!keep.log", "*.log"), "keep.log", false, true},
+		{"escaped bang is literal", parse("", `\!important`), "!important", false, true},
+		{"leading slash anchors to the root", parse("", "/build"), "build", true, true},
+		{"anchored does not match nested", parse("", "/build"), "src/build", true, false},
+		{"middle slash anchors", parse("", "docs/*.md"), "docs/a.md", false, true},
+		{"middle slash does not match nested", parse("", "docs/*.md"), "x/docs/a.md", false, false},
+		{"dir only matches directories", parse("", "out/"), "out", true, true},
+		{"dir only skips files", parse("", "out/"), "out", false, false},
+		{"double star prefix", parse("", "**/tmp"), "a/b/tmp", true, true},
+		{"double star suffix", parse("", "cache/**"), "cache/x/y", false, true},
+		{"nested gitignore is relative to its dir", parse("sub", "/gen"), "sub/gen", true, true},
+		{"nested gitignore does not apply outside", parse("sub", "gen"), "gen", true, false},
+		{"nested unanchored matches below it", parse("sub", "*.tmp"), "sub/a/b.tmp", false, true},
+		{"trailing spaces are ignored", parse("", "*.bak  "), "a.bak", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &ignoreMatcher{rules: tt.rules}
+			if got := m.ignored(tt.rel, tt.isDir); got != tt.ignored {
+				t.Errorf("ignored(%q, dir=%v) = %v, want %v", tt.rel, tt.isDir, got, tt.ignored)
+			}
+		})
+	}
+}
+
+// writeTree 在临时目录中创建文件，内容为空
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestWalkWorkspaceGitignore(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		".gitignore":         "*.log\n/build/\n!keep.log\n",
+		".git/config":        "",
+		"main.go":            "",
+		"debug.log":          "",
+		"keep.log":           "",
+		"build/out.bin":      "",
+		"src/build/x.go":     "",
+		"src/.gitignore":     "gen/\n",
+		"src/gen/a.go":       "",
+		"src/app.go":         "",
+		"src/nested/app.log": "",
+	})
+	walk := func(gitignore bool) []string {
+		files := make([]string, 0)
+		err := walkWorkspace(context.Background(), "", root, gitignore, 0, func(path string, rel string, d fs.DirEntry) error {
+			if !d.IsDir() {
+				files = append(files, rel)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(files)
+		return files
+	}
+
+	want := []string{".gitignore", "keep.log", "main.go", "src/.gitignore", "src/app.go", "src/build/x.go"}
+	if got := walk(true); !slices.Equal(got, want) {
+		t.Errorf("with gitignore got %v, want %v", got, want)
+	}
+	all := walk(false)
+	if slices.Contains(all, ".git/config") {
+		t.Error(".git is not skipped")
+	}
+	if !slices.Contains(all, "debug.log") || !slices.Contains(all, "src/gen/a.go") {
+		t.Errorf("ignored files are missing without gitignore: %v", all)
+	}
+}
+
+func TestWalkWorkspaceSubdirectory(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		".gitignore":                    "node_modules/\n*.log\n/src/app/build/\n",
+		"src/.gitignore":                "*.tmp\n",
+		"src/app/main.go":               "x\n",
+		"src/app/debug.log":             "x\n",
+		"src/app/cache.tmp":             "x\n",
+		"src/app/build/out.go":          "x\n",
+		"src/app/node_modules/x/a.js":   "x\n",
+		"src/app/lib/node_modules/b.js": "x\n",
+		"src/app/lib/lib.go":            "x\n",
+	})
+	paths, err := shared.NewPathPolicy(root, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"lib/lib.go", "main.go"}
+
+	files := make([]string, 0)
+	err = walkWorkspace(context.Background(), paths.Root(), filepath.Join(paths.Root(), "src", "app"), true, 0, func(path string, rel string, d fs.DirEntry) error {
+		if !d.IsDir() {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(files)
+	if !slices.Equal(files, want) {
+		t.Errorf("walk from a subdirectory: got %v, want %v", files, want)
+	}
+
+	// glob 和 grep 从子目录开始时同样使用上层目录的规则
+	args, _ := json.Marshal(GlobToolParam{Pattern: "**/*", Path: "src/app"})
+	output, err := NewGlobTool(paths).Execute(context.Background(), string(args))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ignored := range []string{"debug.log", "cache.tmp", "out.go", "a.js", "b.js"} {
+		if strings.Contains(output, ignored) {
+			t.Errorf("glob in a subdirectory returned the ignored file %s:\n%s", ignored, output)
+		}
+	}
+	args, _ = json.Marshal(GrepToolParam{Pattern: "^", Path: "src/app"})
+	output, err = NewGrepTool(paths).Execute(context.Background(), string(args))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "lib/lib.go\nmain.go\n" {
+		t.Errorf("grep in a subdirectory: got %q, want only lib/lib.go and main.go", output)
+	}
+}
@@ -0,0 +1,149 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/openai/openai-go/v3"
+	shared2 "github.com/openai/openai-go/v3/shared"
+
+	"babyagent/shared"
+)
+
+const (
+	defaultGlobLimit = 100
+	maxGlobLimit     = 1000
+)
+
+// GlobTool 按 glob 模式查找文件，纯 Go 实现，不依赖 shell 或 Node.js
+type GlobTool struct {
+	paths *shared.PathPolicy
+}
+
+// NewGlobTool 只能在 paths 允许读取的目录中查找，paths 为 nil 时不做限制
+func NewGlobTool(paths *shared.PathPolicy) *GlobTool {
+	return &GlobTool{paths: paths}
+}
+
+type GlobToolParam struct {
+	Pattern        string `json:"pattern" jsonschema:"the glob pattern, relative to path"`
+	Path           string `json:"path,omitempty" jsonschema:"the directory to search in, defaults to the current working directory"`
+	Limit          int    `json:"limit,omitempty"`
+	IncludeIgnored bool   `json:"include_ignored,omitempty" jsonschema:"also return files ignored by .gitignore, defaults to false"`
+}
+
+var globToolParameters = mustParametersFor[GlobToolParam](func(s *jsonschema.Schema) {
+	s.Properties["limit"].Description = fmt.Sprintf("the maximum number of results, defaults to %d, at most %d", defaultGlobLimit, maxGlobLimit)
+})
+
+func (t *GlobTool) ToolName() AgentTool {
+	return AgentToolGlob
+}
+
+func (t *GlobTool) ConcurrencySafe(string) bool {
+	return true
+}
+
+func (t *GlobTool) Info() openai.ChatCompletionToolUnionParam {
+	return openai.ChatCompletionFunctionTool(shared2.FunctionDefinitionParam{
+		Name: AgentToolGlob,
+		Description: openai.String("find files and directories by glob pattern, most recently modified first. " +
+			"Supports * ? [abc] {a,b} and ** for any number of directories, e.g. **/*.go. Use pattern * to list a directory like ls. " +
+			"Files ignored by .gitignore and the .git directory are skipped. Directories are shown with a trailing /"),
+		Parameters: globToolParameters,
+	})
+}
+
+type globMatch struct {
+	rel     string
+	modTime time.Time
+}
+
+func (t *GlobTool) Execute(ctx context.Context, argumentsInJSON string) (string, error) {
+	p := GlobToolParam{}
+	err := json.Unmarshal([]byte(argumentsInJSON), &p)
+	if err != nil {
+		return "", err
+	}
+	p.Pattern = strings.TrimPrefix(strings.TrimSpace(p.Pattern), "./")
+	if p.Pattern == "" {
+		return "", errors.New("pattern must not be empty")
+	}
+	if p.Path == "" {
+		p.Path = "."
+	}
+	if p.Limit <= 0 {
+		p.Limit = defaultGlobLimit
+	}
+	p.Limit = min(p.Limit, maxGlobLimit)
+
+	root, err := t.paths.Resolve(p.Path, shared.PathRead)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", p.Path)
+	}
+
+	re, err := regexp.Compile("^" + globToRegexp(p.Pattern) + "$")
+	if err != nil {
+		return "", fmt.Errorf("invalid pattern %q: %w", p.Pattern, err)
+	}
+	// 不含 ** 时模式的层数就是需要遍历的最大深度
+	maxDepth := 0
+	if !strings.Contains(p.Pattern, "**") {
+		maxDepth = strings.Count(p.Pattern, "/") + 1
+	}
+
+	matches := make([]globMatch, 0)
+	err = walkWorkspace(ctx, t.paths.Root(), root, !p.IncludeIgnored, maxDepth, func(path string, rel string, d fs.DirEntry) error {
+		if !re.MatchString(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			rel += "/"
+		}
+		matches = append(matches, globMatch{rel: rel, modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(matches) == 0 {
+		return fmt.Sprintf("no files match %q in %s", p.Pattern, p.Path), nil
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if !matches[i].modTime.Equal(matches[j].modTime) {
+			return matches[i].modTime.After(matches[j].modTime)
+		}
+		return matches[i].rel < matches[j].rel
+	})
+
+	var b strings.Builder
+	for _, match := range matches[:min(len(matches), p.Limit)] {
+		b.WriteString(match.rel)
+		b.WriteString("\n")
+	}
+	if len(matches) > p.Limit {
+		fmt.Fprintf(&b, "[showing the %d most recently modified of %d matches, use a more specific pattern or path to narrow down]\n", p.Limit, len(matches))
+	}
+	return b.String(), nil
+}
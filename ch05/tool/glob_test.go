@@ -0,0 +1,67 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGlobTool(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		".gitignore":       "vendor/\n",
+		"main.go":          "",
+		"go.mod":           "",
+		"cmd/app/main.go":  "",
+		"internal/x/y.go":  "",
+		"internal/x/y.txt": "",
+		"vendor/lib/v.go":  "",
+		"docs/readme.md":   "",
+	})
+	tests := []struct {
+		pattern        string
+		path           string
+		includeIgnored bool
+		want           []string
+	}{
+		{pattern: "*.go", want: []string{"main.go"}},
+		{pattern: "**/*.go", want: []string{"cmd/app/main.go", "internal/x/y.go", "main.go"}},
+		{pattern: "**/*.go", includeIgnored: true, want: []string{"cmd/app/main.go", "internal/x/y.go", "main.go", "vendor/lib/v.go"}},
+		{pattern: "internal/**", want: []string{"internal/x/", "internal/x/y.go", "internal/x/y.txt"}},
+		{pattern: "*/*/main.go", want: []string{"cmd/app/main.go"}},
+		{pattern: "*", path: "internal/x", want: []string{"y.go", "y.txt"}},
+		{pattern: "*.{go,mod}", want: []string{"go.mod", "main.go"}},
+		{pattern: "./docs/*.md", want: []string{"docs/readme.md"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			path := root
+			if tt.path != "" {
+				path = root + "/" + tt.path
+			}
+			args, _ := json.Marshal(GlobToolParam{Pattern: tt.pattern, Path: path, IncludeIgnored: tt.includeIgnored})
+			output, err := NewGlobTool(nil).Execute(context.Background(), string(args))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := strings.Fields(output)
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGlobToolNoMatch(t *testing.T) {
+	root := writeTree(t, map[string]string{"a.txt": ""})
+	args, _ := json.Marshal(GlobToolParam{Pattern: "*.go", Path: root})
+	output, err := NewGlobTool(nil).Execute(context.Background(), string(args))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(output, `no files match "*.go"`) {
+		t.Errorf("unexpected output %q", output)
+	}
+}
@@ -0,0 +1,396 @@
+package tool
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/openai/openai-go/v3"
+	shared2 "github.com/openai/openai-go/v3/shared"
+
+	"babyagent/shared"
+)
+
+const (
+	grepModeFiles   = "files_with_matches"
+	grepModeContent = "content"
+	grepModeCount   = "count"
+
+	defaultGrepLimit = 100
+	maxGrepLimit     = 1000
+	maxGrepContext   = 10
+	// maxGrepFileBytes 超过该大小的文件不搜索
+	maxGrepFileBytes = 10 * 1024 * 1024
+	// maxGrepLineBytes 输出中单行的字节上限
+	maxGrepLineBytes = 500
+	// grepBinarySniffBytes 文件开头的这些字节中包含 NUL 时视为二进制文件
+	grepBinarySniffBytes = 8000
+)
+
+// grepFileTypes type 参数支持的文件类型
+var grepFileTypes = map[string][]string{
+	"go":   {"*.go", "go.mod", "go.sum"},
+	"py":   {"*.py", "*.pyi"},
+	"js":   {"*.js", "*.jsx", "*.mjs", "*.cjs"},
+	"ts":   {"*.ts", "*.tsx", "*.mts", "*.cts"},
+	"java": {"*.java"},
+	"rust": {"*.rs"},
+	"c":    {"*.c", "*.h"},
+	"cpp":  {"*.cpp", "*.cc", "*.cxx", "*.hpp", "*.hh", "*.h"},
+	"sh":   {"*.sh", "*.bash", "*.zsh"},
+	"md":   {"*.md", "*.markdown"},
+	"json": {"*.json", "*.jsonl"},
+	"yaml": {"*.yaml", "*.yml"},
+	"toml": {"*.toml"},
+	"html": {"*.html", "*.htm"},
+	"css":  {"*.css", "*.scss", "*.less"},
+	"sql":  {"*.sql"},
+}
+
+// GrepTool 使用 Go regexp 搜索文件内容，输出与平台无关，没有匹配时不视为错误
+type GrepTool struct {
+	paths *shared.PathPolicy
+}
+
+// NewGrepTool 只能搜索 paths 允许读取的路径，paths 为 nil 时不做限制
+func NewGrepTool(paths *shared.PathPolicy) *GrepTool {
+	return &GrepTool{paths: paths}
+}
+
+type GrepToolParam struct {
+	Pattern         string `json:"pattern" jsonschema:"the regular expression to search for"`
+	Path            string `json:"path,omitempty" jsonschema:"the file or directory to search in, defaults to the current working directory"`
+	Glob            string `json:"glob,omitempty" jsonschema:"only search files matching this glob, e.g. *.go or src/**/*.ts. Patterns without / match the file name"`
+	Type            string `json:"type,omitempty" jsonschema:"only search files of this type"`
+	OutputMode      string `json:"output_mode,omitempty" jsonschema:"files_with_matches lists matching files (default), content shows matching lines, count shows the number of matching lines per file"`
+	Context         int    `json:"context,omitempty"`
+	CaseInsensitive bool   `json:"case_insensitive,omitempty" jsonschema:"ignore case, defaults to false"`
+	Limit           int    `json:"limit,omitempty"`
+	IncludeIgnored  bool   `json:"include_ignored,omitempty" jsonschema:"also search files ignored by .gitignore, defaults to false"`
+}
+
+var grepToolParameters = mustParametersFor[GrepToolParam](func(s *jsonschema.Schema) {
+	types := make([]string, 0, len(grepFileTypes))
+	for name := range grepFileTypes {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	for _, name := range types {
+		s.Properties["type"].Enum = append(s.Properties["type"].Enum, name)
+	}
+	s.Properties["output_mode"].Enum = []any{grepModeFiles, grepModeContent, grepModeCount}
+	s.Properties["context"].Description = fmt.Sprintf("lines of context before and after each match in content mode, at most %d", maxGrepContext)
+	s.Properties["limit"].Description = fmt.Sprintf("the maximum number of files (or matching lines in content mode) to return, defaults to %d, at most %d", defaultGrepLimit, maxGrepLimit)
+})
+
+func (t *GrepTool) ToolName() AgentTool {
+	return AgentToolGrep
+}
+
+func (t *GrepTool) ConcurrencySafe(string) bool {
+	return true
+}
+
+func (t *GrepTool) Info() openai.ChatCompletionToolUnionParam {
+	return openai.ChatCompletionFunctionTool(shared2.FunctionDefinitionParam{
+		Name: AgentToolGrep,
+		Description: openai.String("search file contents with a Go regular expression (RE2 syntax). " +
+			"Files ignored by .gitignore, the .git directory and binary files are skipped. Returns a message instead of an error when nothing matches"),
+		Parameters: grepToolParameters,
+	})
+}
+
+// grepResult 单个文件的搜索结果
+type grepResult struct {
+	rel     string
+	count   int
+	matches []grepLine
+}
+
+type grepLine struct {
+	number int
+	text   string
+	match  bool
+}
+
+func (t *GrepTool) Execute(ctx context.Context, argumentsInJSON string) (string, error) {
+	p := GrepToolParam{}
+	err := json.Unmarshal([]byte(argumentsInJSON), &p)
+	if err != nil {
+		return "", err
+	}
+	if p.Pattern == "" {
+		return "", errors.New("pattern must not be empty")
+	}
+	if p.Path == "" {
+		p.Path = "."
+	}
+	if p.OutputMode == "" {
+		p.OutputMode = grepModeFiles
+	}
+	if p.OutputMode != grepModeFiles && p.OutputMode != grepModeContent && p.OutputMode != grepModeCount {
+		return "", fmt.Errorf("unknown output_mode %q", p.OutputMode)
+	}
+	if p.Limit <= 0 {
+		p.Limit = defaultGrepLimit
+	}
+	p.Limit = min(p.Limit, maxGrepLimit)
+	p.Context = min(max(p.Context, 0), maxGrepContext)
+
+	expr := p.Pattern
+	if p.CaseInsensitive {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return "", fmt.Errorf("invalid pattern: %w", err)
+	}
+	filter, err := newGrepFilter(p.Glob, p.Type)
+	if err != nil {
+		return "", err
+	}
+
+	root, err := t.paths.Resolve(p.Path, shared.PathRead)
+	if err != nil {
+		return "", err
+	}
+	results, err := grepFiles(ctx, t.paths.Root(), root, p, re, filter)
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return fmt.Sprintf("no matches for %q in %s", p.Pattern, p.Path), nil
+	}
+	return formatGrepResults(p, results), nil
+}
+
+// grepFilter 根据 glob 和 type 过滤文件
+type grepFilter struct {
+	glob  *regexp.Regexp
+	base  bool // glob 只匹配文件名
+	types []*regexp.Regexp
+}
+
+func newGrepFilter(glob string, fileType string) (*grepFilter, error) {
+	filter := &grepFilter{}
+	if glob = strings.TrimPrefix(glob, "./"); glob != "" {
+		re, err := regexp.Compile("^" + globToRegexp(glob) + "$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", glob, err)
+		}
+		filter.glob = re
+		filter.base = !strings.Contains(glob, "/")
+	}
+	if fileType != "" {
+		globs, ok := grepFileTypes[fileType]
+		if !ok {
+			return nil, fmt.Errorf("unknown type %q", fileType)
+		}
+		for _, g := range globs {
+			filter.types = append(filter.types, regexp.MustCompile("^"+globToRegexp(g)+"$"))
+		}
+	}
+	return filter, nil
+}
+
+func (f *grepFilter) match(rel string) bool {
+	name := path.Base(rel)
+	if f.glob != nil {
+		target := rel
+		if f.base {
+			target = name
+		}
+		if !f.glob.MatchString(target) {
+			return false
+		}
+	}
+	if len(f.types) == 0 {
+		return true
+	}
+	for _, re := range f.types {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// grepFiles 一个 goroutine 遍历 root，多个 worker 并发搜索文件，结果按路径排序。
+// 遍历时跳过符号链接，不会读取到 root 之外的文件。workspace 用于加载 root 上层目录中的 .gitignore
+func grepFiles(ctx context.Context, workspace string, root string, p GrepToolParam, re *regexp.Regexp, filter *grepFilter) ([]grepResult, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		result, ok := grepFile(root, filepath.Base(p.Path), re, p)
+		if !ok {
+			return nil, nil
+		}
+		return []grepResult{result}, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type job struct {
+		path string
+		rel  string
+	}
+	jobs := make(chan job)
+	var walkErr error
+	go func() {
+		defer close(jobs)
+		walkErr = walkWorkspace(ctx, workspace, root, !p.IncludeIgnored, 0, func(path string, rel string, d fs.DirEntry) error {
+			if !d.Type().IsRegular() || !filter.match(rel) {
+				return nil
+			}
+			select {
+			case jobs <- job{path: path, rel: rel}:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make([]grepResult, 0)
+	for range runtime.NumCPU() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				result, ok := grepFile(j.path, j.rel, re, p)
+				if !ok {
+					continue
+				}
+				mu.Lock()
+				results = append(results, result)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if walkErr != nil {
+		return nil, walkErr
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].rel < results[j].rel
+	})
+	return results, nil
+}
+
+// grepFile 搜索单个文件，跳过二进制文件和过大的文件，没有匹配时返回 false
+func grepFile(path string, rel string, re *regexp.Regexp, p GrepToolParam) (grepResult, bool) {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > maxGrepFileBytes {
+		return grepResult{}, false
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil || bytes.IndexByte(raw[:min(len(raw), grepBinarySniffBytes)], 0) >= 0 {
+		return grepResult{}, false
+	}
+
+	lines := strings.Split(string(raw), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	result := grepResult{rel: rel}
+	// 上一次输出到的行，用于合并重叠的上下文
+	printed := -1
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		if !re.MatchString(line) {
+			continue
+		}
+		result.count++
+		if p.OutputMode != grepModeContent {
+			continue
+		}
+		for j := max(i-p.Context, printed+1); j <= min(i+p.Context, len(lines)-1); j++ {
+			result.matches = append(result.matches, grepLine{
+				number: j + 1,
+				text:   strings.TrimSuffix(lines[j], "\r"),
+				match:  j == i || re.MatchString(strings.TrimSuffix(lines[j], "\r")),
+			})
+			printed = j
+		}
+	}
+	return result, result.count > 0
+}
+
+func formatGrepResults(p GrepToolParam, results []grepResult) string {
+	var b strings.Builder
+	total, shown := 0, 0
+	switch p.OutputMode {
+	case grepModeFiles:
+		for _, result := range results {
+			if shown < p.Limit {
+				fmt.Fprintf(&b, "%s\n", result.rel)
+				shown++
+			}
+		}
+		if len(results) > shown {
+			fmt.Fprintf(&b, "[showing %d of %d matching files, narrow the search with path, glob or type]\n", shown, len(results))
+		}
+	case grepModeCount:
+		for _, result := range results {
+			total += result.count
+			if shown < p.Limit {
+				fmt.Fprintf(&b, "%s:%d\n", result.rel, result.count)
+				shown++
+			}
+		}
+		fmt.Fprintf(&b, "[%d matching lines in %d files]\n", total, len(results))
+	case grepModeContent:
+		for _, result := range results {
+			total += result.count
+			if shown >= p.Limit {
+				continue
+			}
+			last := -1
+			for _, line := range result.matches {
+				if line.match && shown >= p.Limit {
+					break
+				}
+				// 不连续的片段之间以 -- 分隔，有上下文时不同文件之间也分隔
+				if (last >= 0 && line.number != last+1) || (last < 0 && p.Context > 0 && b.Len() > 0) {
+					b.WriteString("--\n")
+				}
+				separator := "-"
+				if line.match {
+					separator = ":"
+					shown++
+				}
+				fmt.Fprintf(&b, "%s%s%d%s%s\n", result.rel, separator, line.number, separator, truncateGrepLine(line.text))
+				last = line.number
+			}
+		}
+		if total > shown {
+			fmt.Fprintf(&b, "[showing %d of %d matching lines in %d files, narrow the search or raise limit]\n", shown, total, len(results))
+		}
+	}
+	return b.String()
+}
+
+func truncateGrepLine(line string) string {
+	if len(line) <= maxGrepLineBytes {
+		return line
+	}
+	return line[:prefixLen(line, maxGrepLineBytes)] + "..."
+}
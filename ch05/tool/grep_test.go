@@ -0,0 +1,109 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestGrepTool(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		".gitignore":      "ignored/\n",
+		"main.go":         "package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n",
+		"util.go":         "package main\n\nfunc helper() string {\n\treturn \"Hello\"\n}\n",
+		"notes.md":        "hello from docs\n",
+		"crlf.txt":        "first\r\nhello crlf\r\n",
+		"bin.dat":         "hello\x00binary",
+		"ignored/x.go":    "hello ignored\n",
+		"sub/deep/a.go":   "x\nx\nhello deep\nx\nx\nx\nx\nhello again\n",
+		"sub/deep/b.json": "{\"hello\": 1}\n",
+	})
+	tests := []struct {
+		name  string
+		param GrepToolParam
+		want  string
+	}{
+		{
+			name:  "files with matches",
+			param: GrepToolParam{Pattern: "hello"},
+			want:  "crlf.txt\nmain.go\nnotes.md\nsub/deep/a.go\nsub/deep/b.json\n",
+		},
+		{
+			name:  "case insensitive",
+			param: GrepToolParam{Pattern: "hello", CaseInsensitive: true, Type: "go"},
+			want:  "main.go\nsub/deep/a.go\nutil.go\n",
+		},
+		{
+			name:  "include ignored",
+			param: GrepToolParam{Pattern: "hello", Glob: "*.go", IncludeIgnored: true},
+			want:  "ignored/x.go\nmain.go\nsub/deep/a.go\n",
+		},
+		{
+			name:  "glob with directory",
+			param: GrepToolParam{Pattern: "hello", Glob: "sub/**/*.json"},
+			want:  "sub/deep/b.json\n",
+		},
+		{
+			name:  "content strips CR",
+			param: GrepToolParam{Pattern: "crlf", OutputMode: grepModeContent},
+			want:  "crlf.txt:2:hello crlf\n",
+		},
+		{
+			name:  "content with context",
+			param: GrepToolParam{Pattern: "hello", Path: "sub", OutputMode: grepModeContent, Context: 1},
+			want:  "deep/a.go-2-x\ndeep/a.go:3:hello deep\ndeep/a.go-4-x\n--\ndeep/a.go-7-x\ndeep/a.go:8:hello again\n--\ndeep/b.json:1:{\"hello\": 1}\n",
+		},
+		{
+			name:  "count",
+			param: GrepToolParam{Pattern: "x", Path: "sub/deep", OutputMode: grepModeCount},
+			want:  "a.go:6\n[6 matching lines in 1 files]\n",
+		},
+		{
+			name:  "limit",
+			param: GrepToolParam{Pattern: "hello", Limit: 2},
+			want:  "crlf.txt\nmain.go\n[showing 2 of 5 matching files, narrow the search with path, glob or type]\n",
+		},
+		{
+			name:  "single file",
+			param: GrepToolParam{Pattern: "package", Path: "util.go", OutputMode: grepModeContent},
+			want:  "util.go:1:package main\n",
+		},
+		{
+			name:  "no match",
+			param: GrepToolParam{Pattern: "nothing"},
+			want:  `no matches for "nothing" in ROOT`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.param
+			p.Path = strings.TrimSuffix(root+"/"+p.Path, "/")
+			args, _ := json.Marshal(p)
+			got, err := NewGrepTool(nil).Execute(context.Background(), string(args))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got = strings.ReplaceAll(got, root, "ROOT"); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrepToolErrors(t *testing.T) {
+	root := writeTree(t, map[string]string{"a.txt": "a\n"})
+	tests := map[string]GrepToolParam{
+		"invalid pattern": {Pattern: "(", Path: root},
+		"unknown type":    {Pattern: "a", Path: root, Type: "cobol"},
+		"unknown mode":    {Pattern: "a", Path: root, OutputMode: "lines"},
+		"empty pattern":   {Path: root},
+		"missing path":    {Pattern: "a", Path: root + "/missing"},
+	}
+	for name, p := range tests {
+		args, _ := json.Marshal(p)
+		if _, err := NewGrepTool(nil).Execute(context.Background(), string(args)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
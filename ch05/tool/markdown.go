@@ -0,0 +1,378 @@
+package tool
+
+import (
+	"bytes"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	// htmlSkipTags 这些元素的内容对阅读没有帮助，整体跳过
+	htmlSkipTags = map[string]bool{
+		"script": true, "style": true, "noscript": true, "template": true, "svg": true, "canvas": true,
+		"nav": true, "footer": true, "aside": true, "form": true, "button": true, "select": true, "iframe": true,
+	}
+	htmlBlockTags = map[string]bool{
+		"p": true, "div": true, "section": true, "article": true, "main": true, "header": true, "figure": true,
+		"figcaption": true, "details": true, "summary": true, "address": true, "dl": true, "center": true,
+	}
+
+	htmlWhitespace  = regexp.MustCompile(`[ \t\r\n\f]+`)
+	htmlLanguage    = regexp.MustCompile(`(?:^|\s)(?:language|lang)-(\S+)`)
+	blankLinesRegex = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlToken HTML 词法单元
+type htmlToken struct {
+	text  string // 文本节点的内容，已经解码实体
+	tag   string // 小写的标签名，文本节点为空
+	end   bool
+	attrs map[string]string
+}
+
+// tokenizeHTML 使用 x/net/html 的词法分析器，跳过注释和 doctype。自闭合标签拆分为开始和结束标签
+func tokenizeHTML(s string) []htmlToken {
+	tokens := make([]htmlToken, 0)
+	z := html.NewTokenizer(strings.NewReader(s))
+	for {
+		tokenType := z.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			// 包括读到结尾的 io.EOF，不规范的标记由词法分析器自行容错
+			return tokens
+		case html.TextToken:
+			tokens = append(tokens, htmlToken{text: string(z.Text())})
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			token := htmlToken{tag: string(name), attrs: make(map[string]string)}
+			for hasAttr {
+				var key, value []byte
+				key, value, hasAttr = z.TagAttr()
+				token.attrs[string(key)] = string(value)
+			}
+			tokens = append(tokens, token)
+			if tokenType == html.SelfClosingTagToken {
+				tokens = append(tokens, htmlToken{tag: token.tag, end: true})
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			tokens = append(tokens, htmlToken{tag: string(name), end: true})
+		}
+	}
+}
+
+// markdownWriter 把 HTML 词法单元转换为 Markdown
+type markdownWriter struct {
+	out       []byte
+	base      *url.URL
+	title     string
+	skip      []string // 正在跳过的元素
+	pre       int
+	fenceEnd  int // 刚写完代码块开头时的位置，用于补上内部 <code> 的语言
+	markerEnd int // 刚写完列表标记时的位置，紧随其后的块级元素不再换行
+	cell      int
+	lists     []markdownList
+	links     []markdownLink
+	quotes    []int
+	tables    []markdownTable
+}
+
+type markdownList struct {
+	ordered bool
+	n       int
+}
+
+type markdownLink struct {
+	start int
+	href  string
+}
+
+type markdownTable struct {
+	rows  int
+	cells int
+}
+
+// htmlToMarkdown 把 HTML 转换为便于阅读的 Markdown，base 用于把相对链接转换为绝对链接。同时返回页面标题
+func htmlToMarkdown(document string, base *url.URL) (string, string) {
+	w := &markdownWriter{base: base, fenceEnd: -1, markerEnd: -1}
+	inTitle := false
+	for _, token := range tokenizeHTML(document) {
+		switch {
+		case token.tag == "title":
+			inTitle = !token.end
+		case token.tag == "":
+			if inTitle {
+				w.title = strings.TrimSpace(htmlWhitespace.ReplaceAllString(token.text, " "))
+			} else if len(w.skip) == 0 {
+				w.text(token.text)
+			}
+		case len(w.skip) > 0:
+			// 跳过的元素内部只关心对应的结束标签
+			if token.end && token.tag == w.skip[len(w.skip)-1] {
+				w.skip = w.skip[:len(w.skip)-1]
+			} else if !token.end && htmlSkipTags[token.tag] {
+				w.skip = append(w.skip, token.tag)
+			}
+		case !token.end && htmlSkipTags[token.tag]:
+			w.skip = append(w.skip, token.tag)
+		case token.end:
+			w.endTag(token.tag)
+		default:
+			w.startTag(token.tag, token.attrs)
+		}
+	}
+
+	lines := strings.Split(string(w.out), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " \t")
+	}
+	result := blankLinesRegex.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(result), w.title
+}
+
+func (w *markdownWriter) write(s string) {
+	w.out = append(w.out, s...)
+}
+
+func (w *markdownWriter) text(s string) {
+	if w.pre > 0 {
+		w.write(s)
+		return
+	}
+	s = htmlWhitespace.ReplaceAllString(s, " ")
+	if s == "" {
+		return
+	}
+	if s[0] == ' ' && (len(w.out) == 0 || strings.ContainsRune(" \n", rune(w.out[len(w.out)-1])) || len(w.out) == w.markerEnd) {
+		s = s[1:]
+	}
+	w.write(s)
+}
+
+// trimSpace 去掉已输出内容末尾的空格
+func (w *markdownWriter) trimSpace() {
+	for len(w.out) > 0 && (w.out[len(w.out)-1] == ' ' || w.out[len(w.out)-1] == '\t') {
+		w.out = w.out[:len(w.out)-1]
+	}
+}
+
+// block 在块级元素边界换行，blank 表示需要空一行
+func (w *markdownWriter) block(blank bool) {
+	if w.pre > 0 || len(w.out) == w.markerEnd {
+		return
+	}
+	if w.cell > 0 {
+		w.text(" ")
+		return
+	}
+	w.trimSpace()
+	if len(w.out) == 0 {
+		return
+	}
+	need := 1
+	if blank && len(w.lists) == 0 {
+		need = 2
+	}
+	have := 0
+	for have < len(w.out) && w.out[len(w.out)-1-have] == '\n' {
+		have++
+	}
+	for ; have < need; have++ {
+		w.write("\n")
+	}
+}
+
+func (w *markdownWriter) startTag(tag string, attrs map[string]string) {
+	switch tag {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		w.block(true)
+		w.write(strings.Repeat("#", int(tag[1]-'0')) + " ")
+	case "br":
+		if w.pre > 0 {
+			w.write("\n")
+		} else {
+			w.block(false)
+		}
+	case "hr":
+		w.block(true)
+		w.write("---")
+		w.block(true)
+	case "pre":
+		w.block(true)
+		w.write("```" + codeLanguage(attrs) + "\n")
+		w.pre++
+		w.fenceEnd = len(w.out)
+	case "code":
+		if w.pre == 0 {
+			w.write("`")
+		} else if len(w.out) == w.fenceEnd {
+			if lang := codeLanguage(attrs); lang != "" && bytes.HasSuffix(w.out, []byte("```\n")) {
+				w.out = append(w.out[:len(w.out)-1], lang+"\n"...)
+				w.fenceEnd = len(w.out)
+			}
+		}
+	case "strong", "b":
+		w.write("**")
+	case "em", "i":
+		w.write("*")
+	case "a":
+		w.links = append(w.links, markdownLink{start: len(w.out), href: attrs["href"]})
+	case "img":
+		src := w.resolve(attrs["src"])
+		if src != "" && !strings.HasPrefix(src, "data:") {
+			w.write("![" + strings.TrimSpace(attrs["alt"]) + "](" + src + ")")
+		}
+	case "ul", "ol":
+		w.block(len(w.lists) == 0)
+		w.lists = append(w.lists, markdownList{ordered: tag == "ol"})
+	case "li":
+		w.markerEnd = -1
+		w.block(false)
+		marker := "- "
+		if n := len(w.lists); n > 0 {
+			w.lists[n-1].n++
+			if w.lists[n-1].ordered {
+				marker = strconv.Itoa(w.lists[n-1].n) + ". "
+			}
+		}
+		w.write(strings.Repeat("  ", max(len(w.lists)-1, 0)) + marker)
+		w.markerEnd = len(w.out)
+	case "blockquote":
+		w.block(true)
+		w.quotes = append(w.quotes, len(w.out))
+	case "dt":
+		w.block(false)
+	case "dd":
+		w.block(false)
+		w.write(": ")
+	case "table":
+		w.block(true)
+		w.tables = append(w.tables, markdownTable{})
+	case "tr":
+		if n := len(w.tables); n > 0 {
+			w.block(false)
+			w.write("|")
+			w.tables[n-1].cells = 0
+		}
+	case "td", "th":
+		if len(w.tables) > 0 {
+			w.write(" ")
+			w.cell++
+		}
+	default:
+		if htmlBlockTags[tag] {
+			w.block(true)
+		}
+	}
+}
+
+func (w *markdownWriter) endTag(tag string) {
+	switch tag {
+	case "h1", "h2", "h3", "h4", "h5", "h6", "p", "hr":
+		w.block(true)
+	case "pre":
+		if w.pre == 0 {
+			return
+		}
+		w.pre--
+		if !bytes.HasSuffix(w.out, []byte("\n")) {
+			w.write("\n")
+		}
+		w.write("```")
+		w.block(true)
+	case "code":
+		if w.pre == 0 {
+			w.write("`")
+		}
+	case "strong", "b":
+		w.write("**")
+	case "em", "i":
+		w.write("*")
+	case "a":
+		n := len(w.links)
+		if n == 0 {
+			return
+		}
+		link := w.links[n-1]
+		w.links = w.links[:n-1]
+		text := strings.TrimSpace(htmlWhitespace.ReplaceAllString(string(w.out[link.start:]), " "))
+		href := w.resolve(link.href)
+		w.out = w.out[:link.start]
+		if href == "" || strings.HasPrefix(link.href, "#") || strings.HasPrefix(href, "javascript:") || text == "" {
+			w.write(text)
+			return
+		}
+		w.write("[" + text + "](" + href + ")")
+	case "ul", "ol":
+		if n := len(w.lists); n > 0 {
+			w.lists = w.lists[:n-1]
+		}
+		w.block(len(w.lists) == 0)
+	case "li", "dt", "dd":
+		w.block(false)
+	case "blockquote":
+		n := len(w.quotes)
+		if n == 0 {
+			return
+		}
+		start := w.quotes[n-1]
+		w.quotes = w.quotes[:n-1]
+		quoted := strings.Split(strings.TrimSpace(string(w.out[start:])), "\n")
+		for i := range quoted {
+			quoted[i] = strings.TrimRight("> "+quoted[i], " ")
+		}
+		w.out = append(w.out[:start], strings.Join(quoted, "\n")...)
+		w.block(true)
+	case "td", "th":
+		if len(w.tables) > 0 && w.cell > 0 {
+			w.cell--
+			w.trimSpace()
+			w.write(" |")
+			w.tables[len(w.tables)-1].cells++
+		}
+	case "tr":
+		n := len(w.tables)
+		if n == 0 {
+			return
+		}
+		table := &w.tables[n-1]
+		// Markdown 表格需要表头，第一行总是作为表头
+		if table.rows == 0 && table.cells > 0 {
+			w.write("\n|" + strings.Repeat(" --- |", table.cells))
+		}
+		table.rows++
+	case "table":
+		if n := len(w.tables); n > 0 {
+			w.tables = w.tables[:n-1]
+		}
+		w.block(true)
+	default:
+		if htmlBlockTags[tag] {
+			w.block(true)
+		}
+	}
+}
+
+// resolve 把相对链接转换为绝对链接
+func (w *markdownWriter) resolve(href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || w.base == nil {
+		return href
+	}
+	u, err := w.base.Parse(href)
+	if err != nil {
+		return href
+	}
+	return u.String()
+}
+
+func codeLanguage(attrs map[string]string) string {
+	if match := htmlLanguage.FindStringSubmatch(attrs["class"]); match != nil {
+		return match[1]
+	}
+	return ""
+}
@@ -0,0 +1,59 @@
+package tool
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestHTMLToMarkdown(t *testing.T) {
+	base, _ := url.Parse("https://example.com/docs/page.html")
+	tests := []struct {
+		name     string
+		html     string
+		markdown string
+		title    string
+	}{
+		{
+			name:     "document",
+			html:     `<html><head><title>A &amp; B</title><style>p{}</style></head><body><nav>menu</nav><h1>Title</h1><p>Hello <b>bold</b> and <a href="/x">link</a>.</p><script>if (a < b) {}</script></body></html>`,
+			markdown: "# Title\n\nHello **bold** and [link](https://example.com/x).",
+			title:    "A & B",
+		},
+		{
+			name:     "nested lists",
+			html:     `<ul><li>one</li><li>two<ol><li>nested</li></ol></li></ul>`,
+			markdown: "- one\n- two\n  1. nested",
+		},
+		{
+			name:     "code block",
+			html:     "<pre><code class=\"language-go\">func main() {\n\tfmt.Println(\"&lt;hi&gt;\")\n}</code></pre>",
+			markdown: "```go\nfunc main() {\n\tfmt.Println(\"<hi>\")\n}\n```",
+		},
+		{
+			name:     "table",
+			html:     `<table><tr><th>a</th><th>b</th></tr><tr><td>1</td><td>2</td></tr></table>`,
+			markdown: "| a | b |\n| --- | --- |\n| 1 | 2 |",
+		},
+		{
+			name:     "quote, line break, image and self-closing skipped element",
+			html:     `<blockquote><p>quoted</p><p>two</p></blockquote><p>x<br/>y</p><img src="i.png" alt="pic"><svg/><p>after svg</p>`,
+			markdown: "> quoted\n>\n> two\n\nx\ny\n\n![pic](https://example.com/docs/i.png)\n\nafter svg",
+		},
+		{
+			name:     "anchors, inline code and stray angle brackets",
+			html:     `<p>a <a href="#top">anchor</a> <a href="javascript:void(0)">js</a> <code>x &lt; y</code> 3 < 4</p><!-- comment -->`,
+			markdown: "a anchor js `x < y` 3 < 4",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			markdown, title := htmlToMarkdown(tt.html, base)
+			if markdown != tt.markdown {
+				t.Errorf("markdown:\ngot  %q\nwant %q", markdown, tt.markdown)
+			}
+			if title != tt.title {
+				t.Errorf("title: got %q, want %q", title, tt.title)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/shared"
+
+	"babyagent/ch05/memory"
+)
+
+const defaultMemorySearchLimit = 10
+
+type MemoryWriteTool struct {
+	store *memory.Store
+}
+
+func NewMemoryWriteTool(store *memory.Store) *MemoryWriteTool {
+	return &MemoryWriteTool{store: store}
+}
+
+type MemoryWriteToolParam struct {
+	ID      string   `json:"id,omitempty" jsonschema:"optional id of an existing memory to update instead of creating a new one, the memory is found in any scope and keeps its scope"`
+	Scope   string   `json:"scope,omitempty" jsonschema:"project for facts about the current repository, user for preferences across projects, defaults to project, ignored when updating by id"`
+	Content string   `json:"content" jsonschema:"the fact to remember, one self-contained sentence"`
+	Tags    []string `json:"tags,omitempty" jsonschema:"optional keywords to help searching"`
+}
+
+var memoryWriteToolParameters = mustParametersFor[MemoryWriteToolParam](func(s *jsonschema.Schema) {
+	s.Properties["scope"].Enum = []any{memory.ScopeProject, memory.ScopeUser}
+})
+
+func (t *MemoryWriteTool) ToolName() AgentTool {
+	return AgentToolMemoryWrite
+}
+
+func (t *MemoryWriteTool) Info() openai.ChatCompletionToolUnionParam {
+	return openai.ChatCompletionFunctionTool(shared.FunctionDefinitionParam{
+		Name:        string(AgentToolMemoryWrite),
+		Description: openai.String("save a durable fact to long-term memory so it is available in future sessions, e.g. project conventions, build and test commands, user preferences"),
+		Parameters:  memoryWriteToolParameters,
+	})
+}
+
+func (t *MemoryWriteTool) Execute(ctx context.Context, argumentsInJSON string) (string, error) {
+	p := MemoryWriteToolParam{}
+	err := json.Unmarshal([]byte(argumentsInJSON), &p)
+	if err != nil {
+		return "", err
+	}
+	if p.Scope == "" {
+		p.Scope = memory.ScopeProject
+	}
+
+	m, err := t.store.Write(p.Scope, p.ID, p.Content, p.Tags)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("saved memory %s in %s scope", m.ID, m.Scope), nil
+}
+
+type MemorySearchTool struct {
+	store *memory.Store
+}
+
+func NewMemorySearchTool(store *memory.Store) *MemorySearchTool {
+	return &MemorySearchTool{store: store}
+}
+
+type MemorySearchToolParam struct {
+	Query string `json:"query,omitempty" jsonschema:"space separated keywords, empty to list the most recent memories"`
+	Scope string `json:"scope,omitempty" jsonschema:"optional scope to search in, defaults to all scopes"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+var memorySearchToolParameters = mustParametersFor[MemorySearchToolParam](func(s *jsonschema.Schema) {
+	s.Properties["scope"].Enum = []any{memory.ScopeProject, memory.ScopeUser}
+	s.Properties["limit"].Description = fmt.Sprintf("the maximum number of memories to return, defaults to %d", defaultMemorySearchLimit)
+})
+
+func (t *MemorySearchTool) ToolName() AgentTool {
+	return AgentToolMemorySearch
+}
+
+func (t *MemorySearchTool) ConcurrencySafe(string) bool {
+	return true
+}
+
+func (t *MemorySearchTool) Info() openai.ChatCompletionToolUnionParam {
+	return openai.ChatCompletionFunctionTool(shared.FunctionDefinitionParam{
+		Name:        string(AgentToolMemorySearch),
+		Description: openai.String("search long-term memory by keywords"),
+		Parameters:  memorySearchToolParameters,
+	})
+}
+
+func (t *MemorySearchTool) Execute(ctx context.Context, argumentsInJSON string) (string, error) {
+	p := MemorySearchToolParam{}
+	err := json.Unmarshal([]byte(argumentsInJSON), &p)
+	if err != nil {
+		return "", err
+	}
+	if p.Limit <= 0 {
+		p.Limit = defaultMemorySearchLimit
+	}
+
+	memories, err := t.store.Search(p.Query, p.Scope, p.Limit)
+	if err != nil {
+		return "", err
+	}
+	if len(memories) == 0 {
+		return "no memories found", nil
+	}
+	return FormatMemories(memories), nil
+}
+
+type MemoryDeleteTool struct {
+	store *memory.Store
+}
+
+func NewMemoryDeleteTool(store *memory.Store) *MemoryDeleteTool {
+	return &MemoryDeleteTool{store: store}
+}
+
+type MemoryDeleteToolParam struct {
+	ID string `json:"id" jsonschema:"the id of the memory to delete"`
+}
+
+var memoryDeleteToolParameters = mustParametersFor[MemoryDeleteToolParam]()
+
+func (t *MemoryDeleteTool) ToolName() AgentTool {
+	return AgentToolMemoryDelete
+}
+
+func (t *MemoryDeleteTool) Info() openai.ChatCompletionToolUnionParam {
+	return openai.ChatCompletionFunctionTool(shared.FunctionDefinitionParam{
+		Name:        string(AgentToolMemoryDelete),
+		Description: openai.String("delete an outdated or wrong memory from long-term memory"),
+		Parameters:  memoryDeleteToolParameters,
+	})
+}
+
+func (t *MemoryDeleteTool) Execute(ctx context.Context, argumentsInJSON string) (string, error) {
+	p := MemoryDeleteToolParam{}
+	err := json.Unmarshal([]byte(argumentsInJSON), &p)
+	if err != nil {
+		return "", err
+	}
+
+	if err := t.store.Delete(p.ID); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("deleted memory %s", p.ID), nil
+}
+
+// FormatMemories 将记忆渲染为模型可读的列表
+func FormatMemories(memories []memory.Memory) string {
+	var b strings.Builder
+	for _, m := range memories {
+		fmt.Fprintf(&b, "- [%s] (%s) %s", m.ID, m.Scope, m.Content)
+		if len(m.Tags) > 0 {
+			fmt.Fprintf(&b, " #%s", strings.Join(m.Tags, " #"))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
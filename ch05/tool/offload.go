@@ -0,0 +1,187 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/shared"
+)
+
+const (
+	defaultReadOffloadLimit = 200
+	maxReadOffloadBytes     = 16 * 1024
+	maxReadOffloadLineBytes = 2000
+)
+
+var offloadHandlePattern = regexp.MustCompile(`^offload-\d+$`)
+
+// OffloadStore 将过大的工具结果卸载到会话的临时目录中，模型只需要持有一个句柄，按需分页或搜索
+type OffloadStore struct {
+	mu      sync.Mutex
+	baseDir string // 为空时使用系统临时目录
+	dir     string // 首次写入时创建
+	seq     int
+}
+
+func NewOffloadStore(baseDir string) *OffloadStore {
+	return &OffloadStore{baseDir: baseDir}
+}
+
+// Save 保存内容并返回句柄
+func (s *OffloadStore) Save(content string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dir == "" {
+		if s.baseDir != "" {
+			if err := os.MkdirAll(s.baseDir, 0755); err != nil {
+				return "", err
+			}
+		}
+		dir, err := os.MkdirTemp(s.baseDir, "babyagent-offload-*")
+		if err != nil {
+			return "", err
+		}
+		s.dir = dir
+	}
+
+	s.seq++
+	handle := fmt.Sprintf("offload-%04d", s.seq)
+	if err := os.WriteFile(filepath.Join(s.dir, handle+".txt"), []byte(content), 0644); err != nil {
+		return "", err
+	}
+	return handle, nil
+}
+
+// Load 根据句柄读取卸载的内容
+func (s *OffloadStore) Load(handle string) (string, error) {
+	if !offloadHandlePattern.MatchString(handle) {
+		return "", fmt.Errorf("invalid handle %q", handle)
+	}
+	s.mu.Lock()
+	dir := s.dir
+	s.mu.Unlock()
+	if dir == "" {
+		return "", fmt.Errorf("handle %q not found", handle)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, handle+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("handle %q not found", handle)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// Clear 删除当前会话卸载的所有内容
+func (s *OffloadStore) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dir == "" {
+		return nil
+	}
+	err := os.RemoveAll(s.dir)
+	s.dir = ""
+	s.seq = 0
+	return err
+}
+
+type ReadOffloadTool struct {
+	store *OffloadStore
+}
+
+func NewReadOffloadTool(store *OffloadStore) *ReadOffloadTool {
+	return &ReadOffloadTool{store: store}
+}
+
+type ReadOffloadToolParam struct {
+	Handle  string `json:"handle" jsonschema:"the handle of the offloaded output, e.g. offload-0001"`
+	Offset  int    `json:"offset,omitempty" jsonschema:"the 1-based line number to start from, defaults to 1"`
+	Limit   int    `json:"limit,omitempty"`
+	Pattern string `json:"pattern,omitempty" jsonschema:"optional Go regular expression, only matching lines after offset are returned"`
+}
+
+var readOffloadToolParameters = mustParametersFor[ReadOffloadToolParam](func(s *jsonschema.Schema) {
+	s.Properties["limit"].Description = fmt.Sprintf("the maximum number of lines to return, defaults to %d", defaultReadOffloadLimit)
+})
+
+func (t *ReadOffloadTool) ToolName() AgentTool {
+	return AgentToolReadOffload
+}
+
+func (t *ReadOffloadTool) ConcurrencySafe(string) bool {
+	return true
+}
+
+func (t *ReadOffloadTool) Info() openai.ChatCompletionToolUnionParam {
+	return openai.ChatCompletionFunctionTool(shared.FunctionDefinitionParam{
+		Name:        string(AgentToolReadOffload),
+		Description: openai.String("read a large tool output that was offloaded to disk, by line range or by regex search"),
+		Parameters:  readOffloadToolParameters,
+	})
+}
+
+func (t *ReadOffloadTool) Execute(ctx context.Context, argumentsInJSON string) (string, error) {
+	p := ReadOffloadToolParam{}
+	err := json.Unmarshal([]byte(argumentsInJSON), &p)
+	if err != nil {
+		return "", err
+	}
+	if p.Offset < 1 {
+		p.Offset = 1
+	}
+	if p.Limit <= 0 {
+		p.Limit = defaultReadOffloadLimit
+	}
+
+	content, err := t.store.Load(p.Handle)
+	if err != nil {
+		return "", err
+	}
+
+	var re *regexp.Regexp
+	if p.Pattern != "" {
+		re, err = regexp.Compile(p.Pattern)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	lines := strings.Split(content, "\n")
+	var b strings.Builder
+	count, i := 0, p.Offset-1
+	for ; i < len(lines) && count < p.Limit; i++ {
+		if re != nil && !re.MatchString(lines[i]) {
+			continue
+		}
+		text := lines[i]
+		if len(text) > maxReadOffloadLineBytes {
+			text = strings.ToValidUTF8(text[:maxReadOffloadLineBytes], "") + "...[line truncated]"
+		}
+		line := fmt.Sprintf("%d: %s\n", i+1, text)
+		if b.Len()+len(line) > maxReadOffloadBytes {
+			break
+		}
+		b.WriteString(line)
+		count++
+	}
+
+	if i < len(lines) {
+		fmt.Fprintf(&b, "[returned %d lines, stopped before line %d of %d, continue with offset %d]", count, i+1, len(lines), i+1)
+	} else {
+		fmt.Fprintf(&b, "[returned %d lines, reached the end (%d lines)]", count, len(lines))
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,114 @@
+package tool
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// OutputPolicy 工具输出进入上下文前的截断策略：超出限制时保留开头和结尾，中间替换为省略标记
+type OutputPolicy struct {
+	// MaxBytes 最大字节数，<= 0 表示不限制
+	MaxBytes int `json:"max_bytes"`
+	// MaxLines 最大行数，<= 0 表示不限制
+	MaxLines int `json:"max_lines"`
+	// HeadPercent 开头部分占预算的百分比，其余留给结尾，取值 0-100
+	HeadPercent int `json:"head_percent"`
+}
+
+// DefaultOutputPolicy 未声明策略的工具（包括 MCP 工具）使用的默认策略
+var DefaultOutputPolicy = OutputPolicy{MaxBytes: 32 * 1024, MaxLines: 1000, HeadPercent: 50}
+
+// OutputLimiter 工具可以实现该接口声明自己的输出策略
+type OutputLimiter interface {
+	OutputPolicy() OutputPolicy
+}
+
+// Apply 按策略截断输出，未超出限制时原样返回
+func (p OutputPolicy) Apply(output string) string {
+	lines := strings.SplitAfter(output, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	bytesExceeded := p.MaxBytes > 0 && len(output) > p.MaxBytes
+	linesExceeded := p.MaxLines > 0 && len(lines) > p.MaxLines
+	if !bytesExceeded && !linesExceeded {
+		return output
+	}
+
+	// 未限制的一项对开头和结尾都不设上限
+	headPercent := min(max(p.HeadPercent, 0), 100)
+	headBytes, tailBytes := len(output), len(output)
+	if p.MaxBytes > 0 {
+		headBytes = p.MaxBytes * headPercent / 100
+		tailBytes = p.MaxBytes - headBytes
+	}
+	headLines, tailLines := len(lines), len(lines)
+	if p.MaxLines > 0 {
+		headLines = p.MaxLines * headPercent / 100
+		tailLines = p.MaxLines - headLines
+	}
+
+	// 开头按整行保留，字节预算放不下下一整行时保留该行的前半部分
+	i, headLen := 0, 0
+	for i < len(lines) && i < headLines && headLen+len(lines[i]) <= headBytes {
+		headLen += len(lines[i])
+		i++
+	}
+	if i < len(lines) && i < headLines {
+		headLen += prefixLen(lines[i], headBytes-headLen)
+	}
+
+	// 结尾同理，不与开头重叠
+	j, tailLen := len(lines), 0
+	for j > i && len(lines)-j < tailLines && tailLen+len(lines[j-1]) <= tailBytes &&
+		len(output)-tailLen-len(lines[j-1]) >= headLen {
+		tailLen += len(lines[j-1])
+		j--
+	}
+	if j > 0 && len(lines)-j < tailLines {
+		rest := min(tailBytes-tailLen, len(output)-tailLen-headLen)
+		tailLen += suffixLen(lines[j-1], rest)
+	}
+
+	head, tail := output[:headLen], output[len(output)-tailLen:]
+	omitted := output[headLen : len(output)-tailLen]
+	var b strings.Builder
+	b.WriteString(head)
+	if head != "" && !strings.HasSuffix(head, "\n") {
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "[... %d bytes (%d lines) omitted, output was %d bytes (%d lines) in total ...]\n",
+		len(omitted), strings.Count(omitted, "\n"), len(output), len(lines))
+	b.WriteString(tail)
+	return b.String()
+}
+
+// prefixLen 返回 s 不超过 n 字节、且不截断 UTF-8 字符的前缀长度
+func prefixLen(s string, n int) int {
+	if n <= 0 {
+		return 0
+	}
+	if n >= len(s) {
+		return len(s)
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return n
+}
+
+// suffixLen 返回 s 不超过 n 字节、且不截断 UTF-8 字符的后缀长度
+func suffixLen(s string, n int) int {
+	if n <= 0 {
+		return 0
+	}
+	if n >= len(s) {
+		return len(s)
+	}
+	start := len(s) - n
+	for start < len(s) && !utf8.RuneStart(s[start]) {
+		start++
+	}
+	return len(s) - start
+}
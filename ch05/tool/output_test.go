@@ -0,0 +1,123 @@
+package tool
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestOutputPolicyApply(t *testing.T) {
+	digits := "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n"
+	tests := []struct {
+		name   string
+		policy OutputPolicy
+		output string
+		want   string
+	}{
+		{
+			name:   "under the limits",
+			policy: OutputPolicy{MaxBytes: 100, MaxLines: 20, HeadPercent: 50},
+			output: digits,
+			want:   digits,
+		},
+		{
+			name:   "exactly at the limits",
+			policy: OutputPolicy{MaxBytes: 20, MaxLines: 10, HeadPercent: 50},
+			output: digits,
+			want:   digits,
+		},
+		{
+			name:   "no limits",
+			policy: OutputPolicy{},
+			output: digits,
+			want:   digits,
+		},
+		{
+			name:   "over the line limit",
+			policy: OutputPolicy{MaxLines: 4, HeadPercent: 50},
+			output: digits,
+			want:   "0\n1\n[... 12 bytes (6 lines) omitted, output was 20 bytes (10 lines) in total ...]\n8\n9\n",
+		},
+		{
+			name:   "over the byte limit keeps whole lines",
+			policy: OutputPolicy{MaxBytes: 8, HeadPercent: 25},
+			output: digits,
+			want:   "0\n[... 12 bytes (6 lines) omitted, output was 20 bytes (10 lines) in total ...]\n7\n8\n9\n",
+		},
+		{
+			name:   "tail only",
+			policy: OutputPolicy{MaxLines: 3, HeadPercent: 0},
+			output: digits,
+			want:   "[... 14 bytes (7 lines) omitted, output was 20 bytes (10 lines) in total ...]\n7\n8\n9\n",
+		},
+		{
+			name:   "a single long line is cut inside the line",
+			policy: OutputPolicy{MaxBytes: 4, HeadPercent: 50},
+			output: "abcdefghij",
+			want:   "ab\n[... 6 bytes (0 lines) omitted, output was 10 bytes (1 lines) in total ...]\nij",
+		},
+		{
+			name:   "multi-byte characters at the cut points",
+			policy: OutputPolicy{MaxBytes: 8, HeadPercent: 50},
+			output: "你好世界和平",
+			want:   "你\n[... 12 bytes (0 lines) omitted, output was 18 bytes (1 lines) in total ...]\n平",
+		},
+		{
+			name:   "multi-byte characters in the kept lines",
+			policy: OutputPolicy{MaxBytes: 20, MaxLines: 2, HeadPercent: 50},
+			output: "第一行\n第二行\n第三行\n",
+			want:   "第一行\n[... 10 bytes (1 lines) omitted, output was 30 bytes (3 lines) in total ...]\n第三行\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.policy.Apply(tt.output)
+			if got != tt.want {
+				t.Errorf("got\n%q\nwant\n%q", got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("the result is not valid UTF-8: %q", got)
+			}
+		})
+	}
+}
+
+func TestOutputPolicyApplyNeverSplitsRunes(t *testing.T) {
+	output := strings.Repeat("中文abc😀\n", 50)
+	for maxBytes := 1; maxBytes < 64; maxBytes++ {
+		for _, headPercent := range []int{0, 30, 50, 100} {
+			got := OutputPolicy{MaxBytes: maxBytes, HeadPercent: headPercent}.Apply(output)
+			if !utf8.ValidString(got) {
+				t.Fatalf("MaxBytes %d, HeadPercent %d: split a character: %q", maxBytes, headPercent, got)
+			}
+			if !strings.Contains(got, " omitted, output was ") {
+				t.Fatalf("MaxBytes %d, HeadPercent %d: missing the omission marker", maxBytes, headPercent)
+			}
+		}
+	}
+}
+
+func TestPrefixSuffixLen(t *testing.T) {
+	s := "a你b" // a 占 1 字节，你 占 3 字节，b 占 1 字节
+	tests := []struct {
+		n            int
+		prefix, tail int
+	}{
+		{n: -1, prefix: 0, tail: 0},
+		{n: 0, prefix: 0, tail: 0},
+		{n: 1, prefix: 1, tail: 1},
+		{n: 2, prefix: 1, tail: 1},
+		{n: 3, prefix: 1, tail: 1},
+		{n: 4, prefix: 4, tail: 4},
+		{n: 5, prefix: 5, tail: 5},
+		{n: 9, prefix: 5, tail: 5},
+	}
+	for _, tt := range tests {
+		if got := prefixLen(s, tt.n); got != tt.prefix {
+			t.Errorf("prefixLen(%q, %d) = %d, want %d", s, tt.n, got, tt.prefix)
+		}
+		if got := suffixLen(s, tt.n); got != tt.tail {
+			t.Errorf("suffixLen(%q, %d) = %d, want %d", s, tt.n, got, tt.tail)
+		}
+	}
+}
@@ -0,0 +1,689 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/openai/openai-go/v3"
+	shared2 "github.com/openai/openai-go/v3/shared"
+
+	"babyagent/shared"
+)
+
+const (
+	patchOpAdd    = "add"
+	patchOpUpdate = "update"
+	patchOpDelete = "delete"
+
+	// patchMaxFuzz 匹配上下文时允许的最大模糊级别：0 精确匹配，1 忽略行尾空白，2 忽略行首和行尾空白
+	patchMaxFuzz = 2
+)
+
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// filePatch 对单个文件的修改
+type filePatch struct {
+	op    string
+	path  string
+	hunks []patchHunk
+	// add 操作的文件内容
+	lines []string
+	noEOL bool
+}
+
+// patchHunk 一段修改。old 为修改前的上下文和删除行，new 为修改后的上下文和新增行
+type patchHunk struct {
+	header string
+	hint   int    // 修改前文件中的起始行（从 0 开始），-1 表示未知
+	anchor string // 新格式中 @@ 之后的定位行
+	old    []string
+	new    []string
+	// context new 中每一行对应的 old 下标，新增行为 -1。应用时上下文行取自文件，模糊匹配时保留文件原有的空白
+	context []int
+	noEOL   bool // 修改后的文件末尾没有换行
+
+	added   int
+	removed int
+}
+
+// ApplyPatchTool 一次修改多个文件。应用前先校验所有 hunk，全部通过后才写入
+type ApplyPatchTool struct {
+	paths *shared.PathPolicy
+}
+
+// NewApplyPatchTool 只能修改 paths 允许修改的文件，paths 为 nil 时不做限制
+func NewApplyPatchTool(paths *shared.PathPolicy) *ApplyPatchTool {
+	return &ApplyPatchTool{paths: paths}
+}
+
+type ApplyPatchToolParam struct {
+	Patch string `json:"patch" jsonschema:"the patch text"`
+}
+
+var applyPatchToolParameters = mustParametersFor[ApplyPatchToolParam]()
+
+func (t *ApplyPatchTool) ToolName() AgentTool {
+	return AgentToolApplyPatch
+}
+
+func (t *ApplyPatchTool) Info() openai.ChatCompletionToolUnionParam {
+	return openai.ChatCompletionFunctionTool(shared2.FunctionDefinitionParam{
+		Name: AgentToolApplyPatch,
+		Description: openai.String("apply a patch that changes one or more files. Accepts a unified diff (--- a/path, +++ b/path, @@ hunks, /dev/null to add or delete files) " +
+			"or the following format:\n" +
+			"*** Begin Patch\n*** Add File: path\n+new line\n*** Update File: path\n@@ optional line to locate the hunk\n context\n-removed\n+added\n*** Delete File: path\n*** End Patch\n" +
+			"Context lines are matched leniently (line numbers and surrounding whitespace may differ). " +
+			"Every hunk is validated before anything is written: if one hunk fails, no file is changed and the failed hunks are reported"),
+		Parameters: applyPatchToolParameters,
+	})
+}
+
+func (t *ApplyPatchTool) Execute(ctx context.Context, argumentsInJSON string) (string, error) {
+	result, err := t.ExecuteResult(ctx, argumentsInJSON)
+	if err != nil {
+		return "", err
+	}
+	return result.Output()
+}
+
+// ExecuteResult 应用补丁，修改的文件和增删的行数记录在结果的元数据中
+func (t *ApplyPatchTool) ExecuteResult(ctx context.Context, argumentsInJSON string) (ToolResult, error) {
+	p := ApplyPatchToolParam{}
+	err := json.Unmarshal([]byte(argumentsInJSON), &p)
+	if err != nil {
+		return ToolResult{}, err
+	}
+
+	patches, err := parsePatch(p.Patch)
+	if err != nil {
+		return ToolResult{}, err
+	}
+	if len(patches) == 0 {
+		return ToolResult{}, errors.New("patch contains no file changes")
+	}
+	return applyPatches(patches, t.paths)
+}
+
+// parsePatch 根据内容判断补丁格式并解析
+func parsePatch(text string) ([]filePatch, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	// 只去掉最后一个换行，末尾省略了空格的空上下文行需要保留
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	for _, line := range lines {
+		if line == "*** Begin Patch" || strings.HasPrefix(line, "*** Add File: ") ||
+			strings.HasPrefix(line, "*** Update File: ") || strings.HasPrefix(line, "*** Delete File: ") {
+			return parseEnvelopePatch(lines)
+		}
+	}
+	return parseUnifiedDiff(lines)
+}
+
+// parseEnvelopePatch 解析 *** Begin Patch 格式
+func parseEnvelopePatch(lines []string) ([]filePatch, error) {
+	patches := make([]filePatch, 0)
+	var current *filePatch
+	var hunk *patchHunk
+	// blank 尚未确定归属的空行数。之后还有 hunk 内容时是省略了开头空格的上下文行，否则是文件之间的分隔，忽略
+	blank := 0
+	flush := func() {
+		if hunk != nil && current != nil {
+			current.hunks = append(current.hunks, *hunk)
+		}
+		hunk = nil
+		if current != nil {
+			patches = append(patches, *current)
+		}
+		current = nil
+	}
+
+	for i, line := range lines {
+		if line == "" && current != nil {
+			blank++
+			continue
+		}
+		pendingBlank := blank
+		blank = 0
+
+		switch {
+		case line == "*** Begin Patch", line == "*** End Patch", line == "*** End of File":
+			continue
+		case strings.HasPrefix(line, "*** Add File: "):
+			flush()
+			current = &filePatch{op: patchOpAdd, path: strings.TrimSpace(strings.TrimPrefix(line, "*** Add File: "))}
+		case strings.HasPrefix(line, "*** Update File: "):
+			flush()
+			current = &filePatch{op: patchOpUpdate, path: strings.TrimSpace(strings.TrimPrefix(line, "*** Update File: "))}
+		case strings.HasPrefix(line, "*** Delete File: "):
+			flush()
+			current = &filePatch{op: patchOpDelete, path: strings.TrimSpace(strings.TrimPrefix(line, "*** Delete File: "))}
+		case strings.HasPrefix(line, "***"):
+			return nil, fmt.Errorf("line %d: unsupported directive %q", i+1, line)
+		case current == nil:
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: expected a *** Add/Update/Delete File header, got %q", i+1, line)
+		case current.op == patchOpAdd:
+			if pendingBlank > 0 {
+				return nil, fmt.Errorf("line %d: lines of an added file must start with +", i-pendingBlank+1)
+			}
+			if !strings.HasPrefix(line, "+") {
+				return nil, fmt.Errorf("line %d: lines of an added file must start with +", i+1)
+			}
+			current.lines = append(current.lines, line[1:])
+		case current.op == patchOpDelete:
+			return nil, fmt.Errorf("line %d: unexpected content after *** Delete File", i+1)
+		case strings.HasPrefix(line, "@@"):
+			if hunk != nil {
+				current.hunks = append(current.hunks, *hunk)
+			}
+			hunk = &patchHunk{header: line, hint: -1, anchor: strings.TrimSpace(strings.TrimPrefix(line, "@@"))}
+		default:
+			if hunk == nil {
+				hunk = &patchHunk{header: fmt.Sprintf("hunk at patch line %d", i-pendingBlank+1), hint: -1}
+			}
+			for range pendingBlank {
+				_ = hunk.addLine("")
+			}
+			if err := hunk.addLine(line); err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+		}
+	}
+	flush()
+	return patches, nil
+}
+
+// parseUnifiedDiff 解析 unified diff。hunk 头中的行数决定 hunk 在哪里结束，起始行号只作为查找位置的参考
+func parseUnifiedDiff(lines []string) ([]filePatch, error) {
+	patches := make([]filePatch, 0)
+	var current *filePatch
+	var hunk *patchHunk
+	oldLeft, newLeft := 0, 0 // 当前 hunk 还剩多少修改前和修改后的行
+	flushHunk := func() {
+		if hunk != nil && current != nil {
+			current.hunks = append(current.hunks, *hunk)
+		}
+		hunk = nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if hunk != nil && (oldLeft > 0 || newLeft > 0) {
+			// hunk 内的行按内容处理，即使它看起来像 --- / +++ 文件头
+			oldCount, newCount := len(hunk.old), len(hunk.new)
+			if err := hunk.addLine(line); err != nil {
+				return nil, fmt.Errorf("line %d: %w (the hunk header %q declares more lines than the hunk contains)", i+1, err, hunk.header)
+			}
+			oldLeft -= len(hunk.old) - oldCount
+			newLeft -= len(hunk.new) - newCount
+			if oldLeft < 0 || newLeft < 0 {
+				return nil, fmt.Errorf("line %d: the hunk has more lines than its header %q declares", i+1, hunk.header)
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, `\`) && hunk != nil:
+			// 紧跟在 hunk 最后一行之后的 \ No newline at end of file
+			_ = hunk.addLine(line)
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			flushHunk()
+			if current != nil {
+				patches = append(patches, *current)
+			}
+			oldPath, newPath := diffPath(line[4:]), diffPath(lines[i+1][4:])
+			current = &filePatch{op: patchOpUpdate, path: newPath}
+			switch {
+			case oldPath == "/dev/null":
+				current.op = patchOpAdd
+			case newPath == "/dev/null":
+				current.op = patchOpDelete
+				current.path = oldPath
+			}
+			i++
+		case strings.HasPrefix(line, "diff "):
+			flushHunk()
+		case strings.HasPrefix(line, "@@"):
+			if current == nil {
+				return nil, fmt.Errorf("line %d: hunk without a --- / +++ file header", i+1)
+			}
+			flushHunk()
+			match := hunkHeaderPattern.FindStringSubmatch(line)
+			if match == nil {
+				return nil, fmt.Errorf("line %d: invalid hunk header %q", i+1, line)
+			}
+			start, _ := strconv.Atoi(match[1])
+			hint := start - 1
+			if match[2] == "0" {
+				// 纯插入时起始行表示插入在该行之后
+				hint = start
+			}
+			oldLeft, newLeft = hunkCount(match[2]), hunkCount(match[4])
+			hunk = &patchHunk{header: line, hint: max(hint, 0)}
+		case hunk != nil && line != "" && strings.ContainsRune(" -+", rune(line[0])):
+			return nil, fmt.Errorf("line %d: the hunk has more lines than its header %q declares", i+1, hunk.header)
+		default:
+			// diff --git、index 等行、文件之间的空行以及补丁前后的说明文字
+			continue
+		}
+	}
+	if hunk != nil && (oldLeft > 0 || newLeft > 0) {
+		return nil, fmt.Errorf("the hunk %q ends before all the lines its header declares", hunk.header)
+	}
+	flushHunk()
+	if current != nil {
+		patches = append(patches, *current)
+	}
+
+	for i := range patches {
+		if patches[i].op != patchOpAdd {
+			continue
+		}
+		for _, hunk := range patches[i].hunks {
+			if len(hunk.old) > 0 {
+				return nil, fmt.Errorf("%s: a new file can only contain added lines", patches[i].path)
+			}
+			patches[i].lines = append(patches[i].lines, hunk.apply(nil)...)
+			patches[i].noEOL = patches[i].noEOL || hunk.noEOL
+		}
+	}
+	return patches, nil
+}
+
+// hunkCount hunk 头中的行数，省略时为 1
+func hunkCount(s string) int {
+	if s == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// diffPath 去掉 diff 文件头中的 a/ b/ 前缀和时间戳
+func diffPath(s string) string {
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimSpace(s)
+	if s == "/dev/null" {
+		return s
+	}
+	if strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/") {
+		return s[2:]
+	}
+	return s
+}
+
+func (h *patchHunk) addLine(line string) error {
+	switch {
+	case line == "":
+		// 模型经常省略空上下文行开头的空格
+		h.context = append(h.context, len(h.old))
+		h.old = append(h.old, "")
+		h.new = append(h.new, "")
+	case line[0] == ' ':
+		h.context = append(h.context, len(h.old))
+		h.old = append(h.old, line[1:])
+		h.new = append(h.new, line[1:])
+		h.noEOL = false
+	case line[0] == '-':
+		h.old = append(h.old, line[1:])
+		h.removed++
+	case line[0] == '+':
+		h.context = append(h.context, -1)
+		h.new = append(h.new, line[1:])
+		h.added++
+		h.noEOL = false
+	case strings.HasPrefix(line, `\ No newline at end of file`):
+		h.noEOL = len(h.new) > 0
+	default:
+		return fmt.Errorf("invalid hunk line %q, lines must start with ' ', '-' or '+'", line)
+	}
+	return nil
+}
+
+// apply 返回 hunk 修改后的内容，matched 为文件中与 old 匹配的行。
+// 上下文行使用文件中的原文，只有新增行取自补丁，模糊匹配不会改动上下文行的空白
+func (h *patchHunk) apply(matched []string) []string {
+	lines := make([]string, 0, len(h.new))
+	for i, line := range h.new {
+		if j := h.context[i]; j >= 0 && j < len(matched) {
+			line = matched[j]
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// fileContent 按行保存的文件内容，记录换行符和末尾是否有换行，写回时保持不变
+type fileContent struct {
+	lines []string
+	eol   string
+	eofNL bool
+}
+
+func splitFileContent(raw string) fileContent {
+	content := fileContent{eol: "\n", eofNL: true}
+	if strings.Count(raw, "\r\n") > strings.Count(raw, "\n")/2 {
+		content.eol = "\r\n"
+	}
+	raw = strings.ReplaceAll(raw, "\r\n", "\n")
+	if raw == "" {
+		return content
+	}
+	content.eofNL = strings.HasSuffix(raw, "\n")
+	content.lines = strings.Split(strings.TrimSuffix(raw, "\n"), "\n")
+	return content
+}
+
+func (c fileContent) String() string {
+	if len(c.lines) == 0 {
+		return ""
+	}
+	s := strings.Join(c.lines, c.eol)
+	if c.eofNL {
+		s += c.eol
+	}
+	return s
+}
+
+// patchResult 单个文件校验后的结果
+type patchResult struct {
+	patch    filePatch
+	target   string // 跟随符号链接后实际读写的路径
+	content  string
+	existed  bool
+	original []byte
+	mode     os.FileMode // 原文件的权限，写入和回滚时保持不变
+	notes    []string
+	added    int
+	removed  int
+}
+
+// applyPatches 先在内存中应用所有修改，全部成功后再写入磁盘。任何一个文件不允许修改时都不会写入
+func applyPatches(patches []filePatch, paths *shared.PathPolicy) (ToolResult, error) {
+	results := make([]patchResult, 0, len(patches))
+	failures := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, patch := range patches {
+		if patch.path == "" {
+			failures = append(failures, "empty file path")
+			continue
+		}
+		target, err := paths.Resolve(patch.path, shared.PathWrite)
+		if err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		if seen[target] {
+			failures = append(failures, fmt.Sprintf("%s: the file appears more than once in the patch", patch.path))
+			continue
+		}
+		seen[target] = true
+
+		result, errs := preparePatch(patch, target)
+		failures = append(failures, errs...)
+		results = append(results, result)
+	}
+	if len(failures) > 0 {
+		return ToolResult{}, fmt.Errorf("patch not applied, no files were changed:\n- %s", strings.Join(failures, "\n- "))
+	}
+
+	if err := commitPatches(results); err != nil {
+		return ToolResult{}, err
+	}
+
+	var b strings.Builder
+	files := make([]string, 0, len(results))
+	added, removed := 0, 0
+	for _, result := range results {
+		files = append(files, result.patch.path)
+		added += result.added
+		removed += result.removed
+		switch result.patch.op {
+		case patchOpAdd:
+			fmt.Fprintf(&b, "A %s (+%d)\n", result.patch.path, result.added)
+		case patchOpDelete:
+			fmt.Fprintf(&b, "D %s\n", result.patch.path)
+		default:
+			fmt.Fprintf(&b, "M %s (+%d -%d)\n", result.patch.path, result.added, result.removed)
+		}
+		for _, note := range result.notes {
+			fmt.Fprintf(&b, "  %s\n", note)
+		}
+	}
+	toolResult := TextResult(b.String())
+	toolResult.Metadata = map[string]any{"files": files, "added": added, "removed": removed}
+	return toolResult, nil
+}
+
+// preparePatch 校验并在内存中应用单个文件的修改，返回所有失败的 hunk
+func preparePatch(patch filePatch, target string) (patchResult, []string) {
+	result := patchResult{patch: patch, target: target, mode: 0644}
+	raw, err := os.ReadFile(target)
+	switch {
+	case err == nil:
+		result.existed = true
+		result.original = raw
+		if info, err := os.Stat(target); err == nil {
+			result.mode = info.Mode().Perm()
+		}
+	case errors.Is(err, os.ErrNotExist):
+	default:
+		return result, []string{fmt.Sprintf("%s: %v", patch.path, err)}
+	}
+
+	switch patch.op {
+	case patchOpAdd:
+		if result.existed {
+			return result, []string{fmt.Sprintf("%s: file already exists, use an update instead", patch.path)}
+		}
+		content := fileContent{lines: patch.lines, eol: "\n", eofNL: !patch.noEOL}
+		result.content = content.String()
+		result.added = len(patch.lines)
+		return result, nil
+	case patchOpDelete:
+		if !result.existed {
+			return result, []string{fmt.Sprintf("%s: file to delete does not exist", patch.path)}
+		}
+		return result, nil
+	}
+
+	if !result.existed {
+		return result, []string{fmt.Sprintf("%s: file to update does not exist", patch.path)}
+	}
+	if len(patch.hunks) == 0 {
+		return result, []string{fmt.Sprintf("%s: no hunks to apply", patch.path)}
+	}
+
+	content := splitFileContent(string(raw))
+	output := make([]string, 0, len(content.lines))
+	failures := make([]string, 0)
+	next := 0 // 下一个 hunk 只在上一个 hunk 之后查找
+	touchesEnd := false
+	noEOL := false
+	for i, hunk := range patch.hunks {
+		pos, fuzz, ok := findHunk(content.lines, hunk, next)
+		if !ok {
+			failures = append(failures, fmt.Sprintf("%s: hunk %d (%s) does not match the file content", patch.path, i+1, hunk.header))
+			continue
+		}
+		if hunk.hint >= 0 && pos != hunk.hint {
+			result.notes = append(result.notes, fmt.Sprintf("hunk %d applied at line %d (offset %+d)", i+1, pos+1, pos-hunk.hint))
+		}
+		if fuzz > 0 {
+			result.notes = append(result.notes, fmt.Sprintf("hunk %d matched with whitespace differences (fuzz %d)", i+1, fuzz))
+		}
+		output = append(output, content.lines[next:pos]...)
+		output = append(output, hunk.apply(content.lines[pos:pos+len(hunk.old)])...)
+		next = pos + len(hunk.old)
+		if next == len(content.lines) {
+			touchesEnd, noEOL = true, hunk.noEOL
+		}
+		result.added += hunk.added
+		result.removed += hunk.removed
+	}
+	if len(failures) > 0 {
+		return result, failures
+	}
+	output = append(output, content.lines[next:]...)
+
+	updated := fileContent{lines: output, eol: content.eol, eofNL: content.eofNL}
+	if touchesEnd {
+		updated.eofNL = !noEOL
+	}
+	result.content = updated.String()
+	return result, nil
+}
+
+// findHunk 在 start 之后查找 hunk 修改前的内容，优先在 hint 附近查找，逐级放宽空白字符的匹配
+func findHunk(lines []string, hunk patchHunk, start int) (int, int, bool) {
+	if hunk.anchor != "" {
+		anchor := -1
+		for i := start; i < len(lines); i++ {
+			if strings.Contains(strings.TrimSpace(lines[i]), hunk.anchor) {
+				anchor = i
+				break
+			}
+		}
+		if anchor < 0 {
+			return 0, 0, false
+		}
+		// 定位行本身可能也是上下文的第一行
+		start = anchor
+		if len(hunk.old) == 0 || normalizeLine(hunk.old[0], patchMaxFuzz) != normalizeLine(lines[anchor], patchMaxFuzz) {
+			start = anchor + 1
+		}
+	}
+
+	last := len(lines) - len(hunk.old)
+	if len(hunk.old) == 0 {
+		// 没有上下文的纯插入：有行号时插入到该位置，否则追加到末尾
+		if hunk.hint >= start && hunk.hint <= len(lines) {
+			return hunk.hint, 0, true
+		}
+		if hunk.anchor != "" {
+			return start, 0, true
+		}
+		return len(lines), 0, true
+	}
+	if last < start {
+		return 0, 0, false
+	}
+
+	hint := hunk.hint
+	if hint < start || hint > last {
+		hint = start
+	}
+	for fuzz := 0; fuzz <= patchMaxFuzz; fuzz++ {
+		// 从 hint 开始向两侧交替查找
+		for d := 0; hint-d >= start || hint+d <= last; d++ {
+			for _, pos := range []int{hint - d, hint + d} {
+				if pos < start || pos > last || (d == 0 && pos != hint) {
+					continue
+				}
+				if matchLines(lines[pos:pos+len(hunk.old)], hunk.old, fuzz) {
+					return pos, fuzz, true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+func matchLines(lines []string, expected []string, fuzz int) bool {
+	for i := range expected {
+		if normalizeLine(lines[i], fuzz) != normalizeLine(expected[i], fuzz) {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeLine(line string, fuzz int) string {
+	line = strings.TrimSuffix(line, "\r")
+	switch fuzz {
+	case 0:
+		return line
+	case 1:
+		return strings.TrimRight(line, " \t")
+	default:
+		return strings.TrimSpace(line)
+	}
+}
+
+// commitPatches 先把所有新内容写入临时文件，再依次 rename 和删除。中途失败时恢复已经修改的文件
+func commitPatches(results []patchResult) error {
+	temps := make(map[int]string)
+	cleanup := func() {
+		for _, tmp := range temps {
+			_ = os.Remove(tmp)
+		}
+	}
+	for i, result := range results {
+		if result.patch.op == patchOpDelete {
+			continue
+		}
+		dir := filepath.Dir(result.target)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			cleanup()
+			return err
+		}
+		tmp, err := os.CreateTemp(dir, "."+filepath.Base(result.target)+".*.tmp")
+		if err != nil {
+			cleanup()
+			return err
+		}
+		temps[i] = tmp.Name()
+		_, err = tmp.WriteString(result.content)
+		if err == nil {
+			err = tmp.Chmod(result.mode)
+		}
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			cleanup()
+			return err
+		}
+	}
+
+	done := make([]int, 0, len(results))
+	rollback := func() {
+		for _, i := range done {
+			result := results[i]
+			if result.existed {
+				// 被删除的文件重新创建时受 umask 影响，再设置一次权限
+				if err := os.WriteFile(result.target, result.original, result.mode); err == nil {
+					_ = os.Chmod(result.target, result.mode)
+				}
+			} else {
+				_ = os.Remove(result.target)
+			}
+		}
+	}
+	for i, result := range results {
+		var err error
+		if result.patch.op == patchOpDelete {
+			err = os.Remove(result.target)
+		} else {
+			err = os.Rename(temps[i], result.target)
+			delete(temps, i)
+		}
+		if err != nil {
+			rollback()
+			cleanup()
+			return fmt.Errorf("failed to write %s, all changes were rolled back: %w", result.patch.path, err)
+		}
+		done = append(done, i)
+	}
+	return nil
+}
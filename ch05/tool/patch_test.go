@@ -0,0 +1,165 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"babyagent/shared"
+)
+
+// applyTestPatch 在临时目录中写入 files 后应用补丁，返回应用后所有文件的内容
+func applyTestPatch(t *testing.T, files map[string]string, patch string) (map[string]string, error) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	paths, err := shared.NewPathPolicy(dir, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, _ := json.Marshal(ApplyPatchToolParam{Patch: patch})
+	_, applyErr := NewApplyPatchTool(paths).Execute(context.Background(), string(args))
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		result[entry.Name()] = string(content)
+	}
+	return result, applyErr
+}
+
+func TestApplyPatchTool(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		patch string
+		want  map[string]string
+		err   string
+	}{
+		{
+			name:  "unified diff lines that look like file headers",
+			files: map[string]string{"f.sql": "a\n-- comment\nb\n"},
+			patch: "--- a/f.sql\n+++ b/f.sql\n@@ -1,3 +1,3 @@\n a\n--- comment\n+++ x\n b\n",
+			want:  map[string]string{"f.sql": "a\n++ x\nb\n"},
+		},
+		{
+			name:  "unified diff blank lines between files are not context",
+			files: map[string]string{"a.txt": "1\n2\n", "b.txt": "x\n\ny\n"},
+			patch: "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n 1\n-2\n+two\n\n--- a/b.txt\n+++ b/b.txt\n@@ -1,3 +1,3 @@\n x\n\n-y\n+why\n",
+			want:  map[string]string{"a.txt": "1\ntwo\n", "b.txt": "x\n\nwhy\n"},
+		},
+		{
+			name:  "unified diff no newline at end of file",
+			files: map[string]string{"f.txt": "a\nb\n"},
+			patch: "--- f.txt\n+++ f.txt\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n\\ No newline at end of file\n",
+			want:  map[string]string{"f.txt": "a\nc"},
+		},
+		{
+			name:  "unified diff hunk longer than its header",
+			files: map[string]string{"f.txt": "a\nb\n"},
+			patch: "--- f.txt\n+++ f.txt\n@@ -1 +1 @@\n-a\n+A\n-b\n+B\n",
+			want:  map[string]string{"f.txt": "a\nb\n"},
+			err:   `line 6: the hunk has more lines than its header "@@ -1 +1 @@" declares`,
+		},
+		{
+			name:  "unified diff hunk shorter than its header",
+			files: map[string]string{"f.txt": "a\nb\n"},
+			patch: "--- f.txt\n+++ f.txt\n@@ -1,2 +1,2 @@\n-a\n+A\n",
+			want:  map[string]string{"f.txt": "a\nb\n"},
+			err:   `the hunk "@@ -1,2 +1,2 @@" ends before all the lines its header declares`,
+		},
+		{
+			name:  "envelope blank line between files",
+			files: map[string]string{"g.txt": "x\ny\n"},
+			patch: "*** Begin Patch\n*** Update File: g.txt\n x\n-y\n+z\n\n*** Add File: h.txt\n+new\n\n*** End Patch\n",
+			want:  map[string]string{"g.txt": "x\nz\n", "h.txt": "new\n"},
+		},
+		{
+			name:  "envelope blank context line without a space",
+			files: map[string]string{"g.txt": "x\n\ny\n"},
+			patch: "*** Begin Patch\n*** Update File: g.txt\n x\n\n-y\n+z\n*** End Patch\n",
+			want:  map[string]string{"g.txt": "x\n\nz\n"},
+		},
+		{
+			name:  "fuzzy match keeps the file's context lines",
+			files: map[string]string{"f.go": "func f() {\n\tx := 1\n\ty := 2\n\treturn\n}\n"},
+			patch: "--- a/f.go\n+++ b/f.go\n@@ -1,5 +1,5 @@\n func f() {\n    x := 1\n-    y := 2\n+    y := 3\n    return\n }\n",
+			want:  map[string]string{"f.go": "func f() {\n\tx := 1\n    y := 3\n\treturn\n}\n"},
+		},
+		{
+			name:  "envelope fuzzy match keeps trailing whitespace of context lines",
+			files: map[string]string{"g.txt": "a  \nb\t\nc\n"},
+			patch: "*** Begin Patch\n*** Update File: g.txt\n a\n-b\n+B\n c\n*** End Patch\n",
+			want:  map[string]string{"g.txt": "a  \nB\nc\n"},
+		},
+		{
+			name:  "envelope failed hunk changes nothing",
+			files: map[string]string{"g.txt": "x\ny\n"},
+			patch: "*** Begin Patch\n*** Add File: h.txt\n+new\n*** Update File: g.txt\n-missing\n+z\n*** End Patch\n",
+			want:  map[string]string{"g.txt": "x\ny\n"},
+			err:   "patch not applied, no files were changed:\n- g.txt: hunk 1 (hunk at patch line 5) does not match the file content",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyTestPatch(t, tt.files, tt.patch)
+			errText := ""
+			if err != nil {
+				errText = err.Error()
+			}
+			if errText != tt.err {
+				t.Errorf("error:\ngot  %q\nwant %q", errText, tt.err)
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("files: got %v, want %v", got, tt.want)
+			}
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("%s:\ngot  %q\nwant %q", name, got[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestCommitPatchesRollbackKeepsMode(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "run.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(script, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// 删除 run.sh 成功后删除不存在的文件失败，run.sh 需要以原来的权限恢复
+	results := []patchResult{
+		{patch: filePatch{op: patchOpDelete, path: "run.sh"}, target: script, existed: true, original: []byte("#!/bin/sh\n"), mode: 0755},
+		{patch: filePatch{op: patchOpDelete, path: "missing.txt"}, target: filepath.Join(dir, "missing.txt"), existed: true, mode: 0644},
+	}
+	err := commitPatches(results)
+	if err == nil || !strings.Contains(err.Error(), "all changes were rolled back") {
+		t.Fatalf("got %v, want a rollback error", err)
+	}
+	info, err := os.Stat(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("restored mode %v, want %v", info.Mode().Perm(), os.FileMode(0755))
+	}
+}
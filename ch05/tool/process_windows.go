@@ -0,0 +1,25 @@
+//go:build windows
+
+package tool
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+)
+
+// shellCommand 使用 cmd.exe 解释命令行
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "cmd", "/C", command)
+}
+
+// setProcessGroup Windows 上通过 taskkill /T 终止进程树，不需要额外设置
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup 终止命令及其所有子进程
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+}
@@ -0,0 +1,185 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openai/openai-go/v3"
+)
+
+const (
+	ContentTypeText  = "text"
+	ContentTypeImage = "image"
+
+	// toolErrorPrefix 失败的工具结果在返回给模型时加上前缀，和内容恰好像错误信息的成功结果区分开
+	toolErrorPrefix = "[tool error] "
+)
+
+// ContentPart 工具结果中的一段内容
+type ContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Data     []byte `json:"data,omitempty"` // 图片的原始字节
+	MIMEType string `json:"mime_type,omitempty"`
+}
+
+// ToolResult 结构化的工具结果。Content 返回给模型，Metadata 只用于界面和日志，例如退出码、修改的文件、是否被截断
+type ToolResult struct {
+	Content  []ContentPart  `json:"content"`
+	IsError  bool           `json:"is_error,omitempty"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// ResultTool 返回结构化结果的工具实现该接口，agent 优先调用 ExecuteResult。
+// 工具失败时返回 IsError 为 true 的结果，error 只用于无法执行的情况
+type ResultTool interface {
+	Tool
+	ExecuteResult(ctx context.Context, argumentsInJSON string) (ToolResult, error)
+}
+
+// TextResult 只包含文本的结果
+func TextResult(text string) ToolResult {
+	return ToolResult{Content: []ContentPart{{Type: ContentTypeText, Text: text}}}
+}
+
+// ErrorResult 表示工具执行失败的结果
+func ErrorResult(err error) ToolResult {
+	result := TextResult(err.Error())
+	result.IsError = true
+	return result
+}
+
+// ExecuteResult 执行工具并返回结构化结果。只实现了 Execute 的工具，返回的 error 转换为 IsError 的结果
+func ExecuteResult(ctx context.Context, t Tool, argumentsInJSON string) ToolResult {
+	if resultTool, ok := t.(ResultTool); ok {
+		result, err := resultTool.ExecuteResult(ctx, argumentsInJSON)
+		if err != nil {
+			return ErrorResult(err)
+		}
+		return result
+	}
+	output, err := t.Execute(ctx, argumentsInJSON)
+	if err != nil {
+		return ErrorResult(err)
+	}
+	return TextResult(output)
+}
+
+// WithMetadata 返回增加了一项元数据的结果
+func (r ToolResult) WithMetadata(key string, value any) ToolResult {
+	metadata := make(map[string]any, len(r.Metadata)+1)
+	maps.Copy(metadata, r.Metadata)
+	metadata[key] = value
+	r.Metadata = metadata
+	return r
+}
+
+// Text 拼接所有文本内容
+func (r ToolResult) Text() string {
+	parts := make([]string, 0, len(r.Content))
+	for _, part := range r.Content {
+		if part.Type == ContentTypeText {
+			parts = append(parts, part.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// render 拼接所有内容，图片用占位说明代替
+func (r ToolResult) render() string {
+	parts := make([]string, 0, len(r.Content))
+	for _, part := range r.Content {
+		switch part.Type {
+		case ContentTypeText:
+			parts = append(parts, part.Text)
+		case ContentTypeImage:
+			parts = append(parts, fmt.Sprintf("[image: %s, %d bytes]", part.MIMEType, len(part.Data)))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// WithText 把文本内容替换为 text，图片保持不变。用于对结果做卸载和截断
+func (r ToolResult) WithText(text string) ToolResult {
+	content := make([]ContentPart, 0, len(r.Content))
+	content = append(content, ContentPart{Type: ContentTypeText, Text: text})
+	for _, part := range r.Content {
+		if part.Type != ContentTypeText {
+			content = append(content, part)
+		}
+	}
+	r.Content = content
+	return r
+}
+
+// Output 转换为 Execute 的返回值，供同时实现 Execute 和 ExecuteResult 的工具使用
+func (r ToolResult) Output() (string, error) {
+	if r.IsError {
+		return "", errors.New(r.render())
+	}
+	return r.render(), nil
+}
+
+// ToolMessage 转换为返回给模型的 tool message。Chat Completions 的 tool message 只支持文本，图片以占位说明代替
+func (r ToolResult) ToolMessage(toolCallID string) openai.ChatCompletionMessageParamUnion {
+	text := r.render()
+	if r.IsError {
+		text = toolErrorPrefix + text
+	}
+	return openai.ToolMessage(text, toolCallID)
+}
+
+// CallToolResult 转换为 MCP 的 CallToolResult，元数据放在 _meta 中
+func (r ToolResult) CallToolResult() *mcp.CallToolResult {
+	result := &mcp.CallToolResult{
+		Content: make([]mcp.Content, 0, len(r.Content)),
+		IsError: r.IsError,
+	}
+	for _, part := range r.Content {
+		switch part.Type {
+		case ContentTypeText:
+			result.Content = append(result.Content, &mcp.TextContent{Text: part.Text})
+		case ContentTypeImage:
+			result.Content = append(result.Content, &mcp.ImageContent{Data: part.Data, MIMEType: part.MIMEType})
+		}
+	}
+	if len(r.Metadata) > 0 {
+		result.Meta = maps.Clone(r.Metadata)
+	}
+	return result
+}
+
+// ResultFromMCP 把 MCP 的 CallToolResult 转换为 ToolResult，不支持的内容类型以文本说明代替
+func ResultFromMCP(mcpResult *mcp.CallToolResult) ToolResult {
+	result := ToolResult{
+		Content: make([]ContentPart, 0, len(mcpResult.Content)),
+		IsError: mcpResult.IsError,
+	}
+	for _, content := range mcpResult.Content {
+		switch c := content.(type) {
+		case *mcp.TextContent:
+			result.Content = append(result.Content, ContentPart{Type: ContentTypeText, Text: c.Text})
+		case *mcp.ImageContent:
+			result.Content = append(result.Content, ContentPart{Type: ContentTypeImage, Data: c.Data, MIMEType: c.MIMEType})
+		case *mcp.EmbeddedResource:
+			if c.Resource == nil {
+				continue
+			}
+			if c.Resource.Text != "" {
+				result.Content = append(result.Content, ContentPart{Type: ContentTypeText, Text: c.Resource.Text})
+				continue
+			}
+			result.Content = append(result.Content, ContentPart{Type: ContentTypeText, Text: fmt.Sprintf("[resource: %s]", c.Resource.URI)})
+		default:
+			result.Content = append(result.Content, ContentPart{Type: ContentTypeText, Text: fmt.Sprintf("[unsupported content: %T]", content)})
+		}
+	}
+	if len(mcpResult.Meta) > 0 {
+		result.Metadata = maps.Clone(map[string]any(mcpResult.Meta))
+	}
+	return result
+}
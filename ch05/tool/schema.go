@@ -0,0 +1,52 @@
+package tool
+
+import (
+	"encoding/json"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/openai/openai-go/v3"
+)
+
+// SchemaFor 使用 jsonschema-go 根据参数结构体生成工具参数的 JSON Schema。
+//
+// 属性名取自 json tag，带 omitempty 或 omitzero 的字段是可选参数，其余字段必填，jsonschema tag 是参数说明。
+// tag 无法表达的约束（可选值、默认值、引用常量的说明）由 adjust 在生成的 schema 上补充，例如
+//
+//	func(s *jsonschema.Schema) { s.Properties["mode"].Enum = []any{"content", "count"} }
+func SchemaFor[P any](adjust ...func(schema *jsonschema.Schema)) (*jsonschema.Schema, error) {
+	schema, err := jsonschema.For[P](nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range adjust {
+		f(schema)
+	}
+	return schema, nil
+}
+
+// mustParametersFor 与 regexp.MustCompile 类似，用于初始化包级别的工具参数 schema。
+// 参数结构体在编译时就已确定，无法生成 schema 属于编程错误
+func mustParametersFor[P any](adjust ...func(schema *jsonschema.Schema)) openai.FunctionParameters {
+	schema, err := SchemaFor[P](adjust...)
+	if err != nil {
+		panic(err)
+	}
+	parameters, err := functionParameters(schema)
+	if err != nil {
+		panic(err)
+	}
+	return parameters
+}
+
+// functionParameters 把 schema 转换为 Chat Completions API 的参数定义
+func functionParameters(schema *jsonschema.Schema) (openai.FunctionParameters, error) {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	var parameters openai.FunctionParameters
+	if err := json.Unmarshal(data, &parameters); err != nil {
+		return nil, err
+	}
+	return parameters, nil
+}
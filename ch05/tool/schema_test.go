@@ -0,0 +1,46 @@
+package tool
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+type schemaTestParam struct {
+	Name  string   `json:"name" jsonschema:"the name"`
+	Count int      `json:"count,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+func TestMustParametersFor(t *testing.T) {
+	parameters := mustParametersFor[schemaTestParam](func(s *jsonschema.Schema) {
+		s.Properties["count"].Default = json.RawMessage("3")
+	})
+	if required := parameters["required"]; !reflect.DeepEqual(required, []any{"name"}) {
+		t.Errorf("required: got %v, want [name]", required)
+	}
+	properties := parameters["properties"].(map[string]any)
+	if description := properties["name"].(map[string]any)["description"]; description != "the name" {
+		t.Errorf("description: got %v", description)
+	}
+	if value := properties["count"].(map[string]any)["default"]; value != float64(3) {
+		t.Errorf("default: got %v", value)
+	}
+	if items := properties["tags"].(map[string]any)["items"]; !reflect.DeepEqual(items, map[string]any{"type": "string"}) {
+		t.Errorf("tags items: got %v", items)
+	}
+}
+
+func TestMustParametersForInvalidParam(t *testing.T) {
+	type invalidParam struct {
+		Ch chan int `json:"ch"`
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("want a panic for the chan field")
+		}
+	}()
+	mustParametersFor[invalidParam]()
+}
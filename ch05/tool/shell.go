@@ -0,0 +1,337 @@
+package tool
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/openai/openai-go/v3"
+	shared2 "github.com/openai/openai-go/v3/shared"
+
+	"babyagent/shared"
+)
+
+// ShellSession 一个长期运行的 sh 进程，多次执行的命令共享工作目录和环境变量。
+// 每条命令之后输出一行带随机 nonce 的哨兵，用来分隔输出并取回退出码和工作目录。
+// shell 每次启动时都从工作区根目录开始
+type ShellSession struct {
+	mu       sync.Mutex
+	paths    *shared.PathPolicy
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	reader   *os.File
+	lines    chan string   // 合并后的 stdout 和 stderr，按行读取，shell 退出时关闭
+	done     chan struct{} // shell 进程退出后关闭
+	sentinel *regexp.Regexp
+	nonce    string
+	cwd      string
+}
+
+func NewShellSession(paths *shared.PathPolicy) *ShellSession {
+	return &ShellSession{paths: paths}
+}
+
+// ShellResult 一条命令的执行结果
+type ShellResult struct {
+	Output   string
+	ExitCode int
+	Cwd      string
+	Killed   bool // 超时被终止，shell 也被终止
+	Exited   bool // 命令使 shell 退出（例如 exit），ExitCode 为 shell 的退出码
+}
+
+// start 启动 shell，调用方需持有锁
+func (s *ShellSession) start() error {
+	if runtime.GOOS == "windows" {
+		return errors.New("persistent shell is not supported on windows, use the bash tool instead")
+	}
+
+	workdir, err := resolveWorkdir(s.paths, "")
+	if err != nil {
+		return err
+	}
+
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	s.nonce = hex.EncodeToString(b)
+	s.sentinel = regexp.MustCompile(`^__BABYAGENT_` + s.nonce + `__ (-?\d+) (.*)$`)
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("sh")
+	cmd.Dir = workdir
+	setProcessGroup(cmd)
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		_ = reader.Close()
+		_ = writer.Close()
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		_ = reader.Close()
+		_ = writer.Close()
+		return err
+	}
+	// 子进程已经持有写端，这里关闭自己的副本，shell 退出后读端才能读到 EOF
+	_ = writer.Close()
+
+	lines := make(chan string, 256)
+	go func() {
+		defer close(lines)
+		r := bufio.NewReader(reader)
+		for {
+			line, err := r.ReadString('\n')
+			if line != "" {
+				lines <- line
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	done := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(done)
+	}()
+
+	s.cmd = cmd
+	s.stdin = stdin
+	s.reader = reader
+	s.lines = lines
+	s.done = done
+	s.cwd = workdir
+	if s.cwd == "" {
+		s.cwd, _ = os.Getwd()
+	}
+	return nil
+}
+
+// stop 终止 shell 及其启动的所有进程，调用方需持有锁
+func (s *ShellSession) stop() {
+	if s.cmd == nil {
+		return
+	}
+	_ = s.stdin.Close()
+	_ = killProcessGroup(s.cmd)
+	// 丢弃剩余输出，直到读取 goroutine 退出。脱离了进程组的子进程可能仍持有管道，等待一段时间后直接关闭读端
+	timer := time.NewTimer(killWaitDelay)
+	defer timer.Stop()
+drain:
+	for {
+		select {
+		case _, ok := <-s.lines:
+			if !ok {
+				break drain
+			}
+		case <-timer.C:
+			_ = s.reader.Close()
+			for range s.lines {
+			}
+			break drain
+		}
+	}
+	_ = s.reader.Close()
+	s.cmd = nil
+}
+
+// Run 在 shell 中执行命令。超时时终止整个 shell，下次执行时重新启动，之前的工作目录和环境变量会丢失
+func (s *ShellSession) Run(ctx context.Context, command string, timeout time.Duration) (ShellResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 先检查语法，未闭合的引号等错误发送到 shell 后会一直等待后续输入直到超时，导致 shell 被终止
+	if err := checkShellSyntax(ctx, command); err != nil {
+		return ShellResult{}, err
+	}
+	if s.cmd == nil {
+		if err := s.start(); err != nil {
+			return ShellResult{}, err
+		}
+	}
+
+	// 命令放在 { } 中执行，cd、export 等会影响当前 shell；stdin 重定向到 /dev/null，避免命令读走后续的输入
+	script := fmt.Sprintf("{\n%s\n} < /dev/null\nprintf '\\n__BABYAGENT_%s__ %%d %%s\\n' \"$?\" \"$PWD\"\n", command, s.nonce)
+	if _, err := io.WriteString(s.stdin, script); err != nil {
+		s.stop()
+		return ShellResult{}, fmt.Errorf("shell exited unexpectedly: %w", err)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var output strings.Builder
+	for {
+		select {
+		case line, ok := <-s.lines:
+			if !ok {
+				// 输出管道已关闭，shell 已经退出或即将退出，取回它的退出码
+				exitCode := -1
+				select {
+				case <-s.done:
+					exitCode = s.cmd.ProcessState.ExitCode()
+				case <-time.After(killWaitDelay):
+				}
+				s.stop()
+				return ShellResult{Output: output.String(), ExitCode: exitCode, Cwd: s.cwd, Exited: true}, nil
+			}
+			match := s.sentinel.FindStringSubmatch(strings.TrimSuffix(line, "\n"))
+			if match == nil {
+				output.WriteString(line)
+				continue
+			}
+			exitCode, _ := strconv.Atoi(match[1])
+			s.cwd = match[2]
+			// 去掉哨兵之前额外输出的换行
+			return ShellResult{Output: strings.TrimSuffix(output.String(), "\n"), ExitCode: exitCode, Cwd: s.cwd}, nil
+		case <-timer.C:
+			s.stop()
+			return ShellResult{Output: output.String(), ExitCode: -1, Cwd: s.cwd, Killed: true}, nil
+		case <-ctx.Done():
+			s.stop()
+			return ShellResult{}, ctx.Err()
+		}
+	}
+}
+
+// checkShellSyntax 用 sh -n 检查命令的语法，命令按 Run 中同样的方式包装
+func checkShellSyntax(ctx context.Context, command string) error {
+	cmd := exec.CommandContext(ctx, "sh", "-n")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("{\n%s\n} < /dev/null\n", command))
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	return fmt.Errorf("syntax error, the command was not executed: %s", strings.TrimSpace(string(output)))
+}
+
+// Restart 终止当前 shell 并启动一个新的 shell
+func (s *ShellSession) Restart() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stop()
+	if err := s.start(); err != nil {
+		return "", err
+	}
+	return s.cwd, nil
+}
+
+// Close 终止 shell，之后再执行命令会自动重新启动
+func (s *ShellSession) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stop()
+	return nil
+}
+
+// ShellTool 在会话内共享的 shell 中执行命令，工作目录和环境变量在多次调用之间保留
+type ShellTool struct {
+	session *ShellSession
+}
+
+func NewShellTool(paths *shared.PathPolicy) *ShellTool {
+	return &ShellTool{session: NewShellSession(paths)}
+}
+
+type ShellToolParam struct {
+	Command string `json:"command,omitempty" jsonschema:"the command to execute"`
+	Timeout int    `json:"timeout,omitempty"`
+	Restart bool   `json:"restart,omitempty" jsonschema:"restart the shell before running command, command can be omitted to only restart"`
+}
+
+var shellToolParameters = mustParametersFor[ShellToolParam](func(s *jsonschema.Schema) {
+	s.Properties["timeout"].Description = fmt.Sprintf("timeout in seconds, defaults to %d, at most %d. On timeout the shell is killed and restarted, losing its state",
+		int(defaultBashTimeout.Seconds()), int(maxBashTimeout.Seconds()))
+})
+
+func (t *ShellTool) ToolName() AgentTool {
+	return AgentToolShell
+}
+
+func (t *ShellTool) OutputPolicy() OutputPolicy {
+	return OutputPolicy{MaxBytes: 24 * 1024, MaxLines: 400, HeadPercent: 30}
+}
+
+func (t *ShellTool) Info() openai.ChatCompletionToolUnionParam {
+	return openai.ChatCompletionFunctionTool(shared2.FunctionDefinitionParam{
+		Name: AgentToolShell,
+		Description: openai.String("execute a command in a persistent sh session: the working directory and exported variables are kept between calls, " +
+			"so `cd subdir` or `export FOO=1` affect later commands. Returns the combined output, the exit code and the current working directory. " +
+			"Commands can not read stdin. Use restart to get a fresh shell"),
+		Parameters: shellToolParameters,
+	})
+}
+
+func (t *ShellTool) Execute(ctx context.Context, argumentsInJSON string) (string, error) {
+	p := ShellToolParam{}
+	err := json.Unmarshal([]byte(argumentsInJSON), &p)
+	if err != nil {
+		return "", err
+	}
+
+	if p.Restart {
+		cwd, err := t.session.Restart()
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(p.Command) == "" {
+			return fmt.Sprintf("[shell restarted, cwd: %s]", cwd), nil
+		}
+	}
+	if strings.TrimSpace(p.Command) == "" {
+		return "", errors.New("command must not be empty")
+	}
+
+	timeout := defaultBashTimeout
+	if p.Timeout > 0 {
+		timeout = min(time.Duration(p.Timeout)*time.Second, maxBashTimeout)
+	}
+	result, err := t.session.Run(ctx, p.Command, timeout)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString(result.Output)
+	if result.Output != "" && !strings.HasSuffix(result.Output, "\n") {
+		b.WriteString("\n")
+	}
+	if result.Killed {
+		fmt.Fprintf(&b, "[killed: command timed out after %s, the shell was killed and the next command starts a fresh one]", timeout)
+		return b.String(), nil
+	}
+	if result.Exited {
+		fmt.Fprintf(&b, "[shell exited with code %d, the next command starts a fresh shell, the working directory and variables are reset]", result.ExitCode)
+		return b.String(), nil
+	}
+	fmt.Fprintf(&b, "[exit code: %d, cwd: %s]", result.ExitCode, result.Cwd)
+	return b.String(), nil
+}
+
+func (t *ShellTool) Close() error {
+	return t.session.Close()
+}
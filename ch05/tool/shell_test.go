@@ -0,0 +1,85 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"babyagent/shared"
+)
+
+func runShell(t *testing.T, shell *ShellTool, command string) (string, error) {
+	t.Helper()
+	args, _ := json.Marshal(ShellToolParam{Command: command, Timeout: 5})
+	return shell.Execute(context.Background(), string(args))
+}
+
+func TestShellTool(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("persistent shell is not supported on windows")
+	}
+	dir := t.TempDir()
+	shell := NewShellTool(nil)
+	defer shell.Close()
+
+	if _, err := runShell(t, shell, "cd "+dir+" && export FOO=bar"); err != nil {
+		t.Fatal(err)
+	}
+	output, err := runShell(t, shell, "echo $FOO; pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "bar\n" + dir + "\n[exit code: 0, cwd: " + dir + "]"; output != want {
+		t.Errorf("state not kept between commands:\ngot  %q\nwant %q", output, want)
+	}
+
+	// 语法错误不发送到 shell，工作目录和变量保留
+	start := time.Now()
+	_, err = runShell(t, shell, `echo "unterminated`)
+	if err == nil || !strings.Contains(err.Error(), "syntax error") {
+		t.Errorf("unterminated quote: got %v, want a syntax error", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("syntax error took %s, it should not wait for the timeout", time.Since(start))
+	}
+	output, err = runShell(t, shell, "echo $FOO")
+	if err != nil || !strings.HasPrefix(output, "bar\n") {
+		t.Errorf("state lost after syntax error: %q, %v", output, err)
+	}
+
+	// 命令使 shell 退出时保留输出和退出码
+	output, err = runShell(t, shell, "echo before exit; exit 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(output, "before exit\n[shell exited with code 3,") {
+		t.Errorf("exit: got %q", output)
+	}
+	output, err = runShell(t, shell, "echo restarted")
+	if err != nil || !strings.HasPrefix(output, "restarted\n[exit code: 0") {
+		t.Errorf("shell not restarted after exit: %q, %v", output, err)
+	}
+}
+
+func TestShellToolStartsInWorkspace(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("persistent shell is not supported on windows")
+	}
+	paths, err := shared.NewPathPolicy(t.TempDir(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shell := NewShellTool(paths)
+	defer shell.Close()
+
+	output, err := runShell(t, shell, "pwd -P")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := paths.Root() + "\n[exit code: 0, cwd: " + paths.Root() + "]"; output != want {
+		t.Errorf("got %q, want %q", output, want)
+	}
+}
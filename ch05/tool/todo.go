@@ -0,0 +1,135 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/shared"
+)
+
+const (
+	TodoStatusPending    = "pending"
+	TodoStatusInProgress = "in_progress"
+	TodoStatusDone       = "done"
+)
+
+// TodoItem 任务列表中的一项
+type TodoItem struct {
+	Content string `json:"content" jsonschema:"short imperative description of the task"`
+	Status  string `json:"status"`
+}
+
+// TodoList 会话中模型维护的任务列表，由 Agent 持有，随会话保存
+type TodoList struct {
+	mu    sync.Mutex
+	items []TodoItem
+}
+
+func NewTodoList() *TodoList {
+	return &TodoList{}
+}
+
+// Items 返回任务列表的副本
+func (l *TodoList) Items() []TodoItem {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]TodoItem(nil), l.items...)
+}
+
+// Set 整体替换任务列表
+func (l *TodoList) Set(items []TodoItem) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.items = append([]TodoItem(nil), items...)
+}
+
+// FormatTodos 把任务列表渲染为纯文本，每行一项
+func FormatTodos(items []TodoItem) string {
+	lines := make([]string, 0, len(items))
+	for _, item := range items {
+		mark := "[ ]"
+		switch item.Status {
+		case TodoStatusInProgress:
+			mark = "[~]"
+		case TodoStatusDone:
+			mark = "[x]"
+		}
+		lines = append(lines, mark+" "+item.Content)
+	}
+	return strings.Join(lines, "\n")
+}
+
+type TodoWriteToolParam struct {
+	Todos []TodoItem `json:"todos" jsonschema:"the complete task list in execution order"`
+}
+
+var todoWriteToolParameters = mustParametersFor[TodoWriteToolParam](func(s *jsonschema.Schema) {
+	s.Properties["todos"].Items.Properties["status"].Enum = []any{TodoStatusPending, TodoStatusInProgress, TodoStatusDone}
+})
+
+// TodoWriteTool 模型通过该工具整体更新任务列表，用来在多步骤任务中跟踪进度
+type TodoWriteTool struct {
+	list *TodoList
+}
+
+func NewTodoWriteTool(list *TodoList) *TodoWriteTool {
+	return &TodoWriteTool{list: list}
+}
+
+func (t *TodoWriteTool) ToolName() AgentTool {
+	return AgentToolTodoWrite
+}
+
+func (t *TodoWriteTool) Info() openai.ChatCompletionToolUnionParam {
+	return openai.ChatCompletionFunctionTool(shared.FunctionDefinitionParam{
+		Name: string(AgentToolTodoWrite),
+		Description: openai.String("create or update the task list for the current session. Use it for tasks with three or more steps: " +
+			"write the plan up front, mark a task in_progress before starting it and done right after finishing it. " +
+			"Always send the complete list, it replaces the previous one. At most one task can be in_progress"),
+		Parameters: todoWriteToolParameters,
+	})
+}
+
+func (t *TodoWriteTool) Execute(ctx context.Context, argumentsInJSON string) (string, error) {
+	p := TodoWriteToolParam{}
+	err := json.Unmarshal([]byte(argumentsInJSON), &p)
+	if err != nil {
+		return "", err
+	}
+	return writeTodos(t.list, p.Todos)
+}
+
+func writeTodos(list *TodoList, todos []TodoItem) (string, error) {
+	inProgress, done := 0, 0
+	for i := range todos {
+		todos[i].Content = strings.TrimSpace(todos[i].Content)
+		if todos[i].Content == "" {
+			return "", fmt.Errorf("todo %d has empty content", i+1)
+		}
+		switch todos[i].Status {
+		case TodoStatusPending:
+		case TodoStatusInProgress:
+			inProgress++
+		case TodoStatusDone:
+			done++
+		default:
+			return "", fmt.Errorf("todo %d has invalid status %q, must be one of %s, %s, %s",
+				i+1, todos[i].Status, TodoStatusPending, TodoStatusInProgress, TodoStatusDone)
+		}
+	}
+	if inProgress > 1 {
+		return "", errors.New("only one todo can be in_progress at a time")
+	}
+
+	list.Set(todos)
+	if len(todos) == 0 {
+		return "todo list cleared", nil
+	}
+	return fmt.Sprintf("todo list updated (%d/%d done):\n%s", done, len(todos), FormatTodos(todos)), nil
+}
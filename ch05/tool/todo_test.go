@@ -0,0 +1,30 @@
+package tool
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestTodoWriteTool(t *testing.T) {
+	items := todoWriteToolParameters["properties"].(map[string]any)["todos"].(map[string]any)["items"].(map[string]any)
+	status := items["properties"].(map[string]any)["status"].(map[string]any)
+	if enum := status["enum"]; !reflect.DeepEqual(enum, []any{TodoStatusPending, TodoStatusInProgress, TodoStatusDone}) {
+		t.Errorf("status enum: got %v", enum)
+	}
+
+	list := NewTodoList()
+	todo := NewTodoWriteTool(list)
+	if _, err := todo.Execute(context.Background(), `{"todos":[{"content":"a","status":"in_progress"},{"content":"b","status":"pending"}]}`); err != nil {
+		t.Fatal(err)
+	}
+	if got := FormatTodos(list.Items()); got != "[~] a\n[ ] b" {
+		t.Errorf("got %q", got)
+	}
+	if _, err := todo.Execute(context.Background(), `{"todos":[{"content":"a","status":"in_progress"},{"content":"b","status":"in_progress"}]}`); err == nil {
+		t.Error("two in_progress todos: want an error")
+	}
+	if got := FormatTodos(list.Items()); got != "[~] a\n[ ] b" {
+		t.Errorf("a rejected update changed the list: %q", got)
+	}
+}
@@ -9,10 +9,26 @@ import (
 type AgentTool = string
 
 const (
-	AgentToolRead  AgentTool = "read"
-	AgentToolWrite AgentTool = "write"
-	AgentToolEdit  AgentTool = "edit"
-	AgentToolBash  AgentTool = "bash"
+	AgentToolRead       AgentTool = "read"
+	AgentToolWrite      AgentTool = "write"
+	AgentToolEdit       AgentTool = "edit"
+	AgentToolBash       AgentTool = "bash"
+	AgentToolGlob       AgentTool = "glob"
+	AgentToolGrep       AgentTool = "grep"
+	AgentToolShell      AgentTool = "shell"
+	AgentToolApplyPatch AgentTool = "apply_patch"
+	AgentToolFetch      AgentTool = "fetch"
+	AgentToolTodoWrite  AgentTool = "todo_write"
+
+	AgentToolReadOffload  AgentTool = "read_offload"
+	AgentToolMemoryWrite  AgentTool = "memory_write"
+	AgentToolMemorySearch AgentTool = "memory_search"
+	AgentToolMemoryDelete AgentTool = "memory_delete"
+
+	AgentToolBackgroundStart  AgentTool = "bg_start"
+	AgentToolBackgroundOutput AgentTool = "bg_output"
+	AgentToolBackgroundStatus AgentTool = "bg_status"
+	AgentToolBackgroundKill   AgentTool = "bg_kill"
 )
 
 type Tool interface {
@@ -20,3 +36,16 @@ type Tool interface {
 	Info() openai.ChatCompletionToolUnionParam
 	Execute(ctx context.Context, argumentsInJSON string) (string, error)
 }
+
+// SessionCloser 持有会话级资源（例如长期运行的进程）的工具实现该接口，会话重置或 agent 退出时由 agent 调用释放。
+// Close 之后工具仍然可用，需要时重新创建资源
+type SessionCloser interface {
+	Close() error
+}
+
+// ConcurrencySafe 只读或者内部已经做好同步的工具实现该接口并返回 true，
+// 同一条 assistant 消息中的多个这类调用会并发执行，其余工具按顺序逐个执行。
+// 是否安全可能取决于参数（例如 HTTP 方法），所以按每次调用的参数判断，参数无法解析时应返回 false
+type ConcurrencySafe interface {
+	ConcurrencySafe(argumentsInJSON string) bool
+}
@@ -0,0 +1,109 @@
+package ch05
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go/v3"
+
+	"babyagent/ch05/tool"
+)
+
+// executeToolCalls 执行一条 assistant 消息中的所有工具调用，返回的结果与 toolCalls 顺序一致。
+// 连续的并发安全调用分为一批，批内最多 MaxParallelToolCalls 个同时执行；其他调用单独执行，
+// 它们之前和之后的调用不会与它重叠，保持原有的先后依赖
+func (a *Agent) executeToolCalls(ctx context.Context, toolCalls []openai.ChatCompletionMessageToolCallUnion, viewCh chan MessageVO) []tool.ToolResult {
+	results := make([]tool.ToolResult, len(toolCalls))
+	for start := 0; start < len(toolCalls); {
+		end := start + 1
+		if a.concurrencySafe(toolCalls[start]) {
+			for end < len(toolCalls) && a.concurrencySafe(toolCalls[end]) {
+				end++
+			}
+		}
+		a.executeBatch(ctx, toolCalls[start:end], results[start:end], viewCh)
+		start = end
+	}
+	return results
+}
+
+func (a *Agent) executeBatch(ctx context.Context, toolCalls []openai.ChatCompletionMessageToolCallUnion, results []tool.ToolResult, viewCh chan MessageVO) {
+	workers := min(max(a.contextConf.MaxParallelToolCalls, 1), len(toolCalls))
+	if workers == 1 {
+		for i, toolCall := range toolCalls {
+			results[i] = a.executeToolCall(ctx, toolCall, viewCh)
+		}
+		return
+	}
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, toolCall := range toolCalls {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = a.executeToolCall(ctx, toolCall, viewCh)
+		}()
+	}
+	wg.Wait()
+}
+
+// executeToolCall 执行单个工具调用并发送开始和结束事件，返回写入 tool message 的结果
+func (a *Agent) executeToolCall(ctx context.Context, toolCall openai.ChatCompletionMessageToolCallUnion, viewCh chan MessageVO) tool.ToolResult {
+	viewCh <- MessageVO{
+		Type: MessageTypeToolCall,
+		ToolCall: &ToolCallVO{
+			ID:        toolCall.ID,
+			Name:      toolCall.Function.Name,
+			Arguments: toolCall.Function.Arguments,
+		},
+	}
+
+	started := time.Now()
+	result := a.execute(ctx, toolCall.Function.Name, toolCall.Function.Arguments)
+	if result.IsError {
+		errText := result.Text()
+		viewCh <- MessageVO{
+			Type:    MessageTypeError,
+			Content: &errText,
+		}
+
+	} else if toolCall.Function.Name == tool.AgentToolTodoWrite {
+		viewCh <- MessageVO{
+			Type:  MessageTypeTodo,
+			Todos: a.Todos(),
+		}
+	}
+
+	// 过大的结果先完整卸载到磁盘，再按输出策略截断，避免卸载的内容不完整
+	result = a.offloadToolResult(toolCall.Function.Name, result)
+	result = a.limitToolOutput(toolCall.Function.Name, result)
+	log.Printf("tool call %s, arguments %s, is error: %v, metadata: %v", toolCall.Function.Name, toolCall.Function.Arguments, result.IsError, result.Metadata)
+
+	viewCh <- MessageVO{
+		Type: MessageTypeToolDone,
+		ToolCall: &ToolCallVO{
+			ID:        toolCall.ID,
+			Name:      toolCall.Function.Name,
+			Arguments: toolCall.Function.Arguments,
+			Duration:  time.Since(started),
+			IsError:   result.IsError,
+			Metadata:  result.Metadata,
+		},
+	}
+	return result
+}
+
+// concurrencySafe 工具是否声明这次调用可以与其他调用并发执行
+func (a *Agent) concurrencySafe(toolCall openai.ChatCompletionMessageToolCallUnion) bool {
+	t, ok := a.findTool(toolCall.Function.Name)
+	if !ok {
+		return false
+	}
+	safe, ok := t.(tool.ConcurrencySafe)
+	return ok && safe.ConcurrencySafe(toolCall.Function.Arguments)
+}
@@ -0,0 +1,282 @@
+package ch05
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go/v3"
+
+	"babyagent/ch05/tool"
+)
+
+const turnTitleRunes = 40
+
+// turnNode 对话树中的一个节点，对应一轮对话：以一条 user 消息开始，包含之后的 assistant 和 tool 消息。
+// 根节点（id 为 0）只包含 system prompt
+type turnNode struct {
+	ID       int                                      `json:"id"`
+	Parent   int                                      `json:"parent"`
+	Messages []openai.ChatCompletionMessageParamUnion `json:"messages"`
+	Times    []time.Time                              `json:"times"`
+}
+
+// conversationTree 以树的形式保存对话历史，从根节点到 head 的路径就是当前分支。
+// 回退到更早的轮次再继续对话会产生新的分支，原来的分支仍然保留，可以随时切换回去
+type conversationTree struct {
+	turns []*turnNode // 下标即 id，只追加
+	head  int
+}
+
+func newConversationTree(system openai.ChatCompletionMessageParamUnion, t time.Time) *conversationTree {
+	return &conversationTree{
+		turns: []*turnNode{{
+			ID:       0,
+			Parent:   -1,
+			Messages: []openai.ChatCompletionMessageParamUnion{system},
+			Times:    []time.Time{t},
+		}},
+	}
+}
+
+// addTurn 在 parent 下新增一轮对话
+func (t *conversationTree) addTurn(parent int, messages []openai.ChatCompletionMessageParamUnion, times []time.Time) int {
+	id := len(t.turns)
+	t.turns = append(t.turns, &turnNode{
+		ID:       id,
+		Parent:   parent,
+		Messages: messages,
+		Times:    times,
+	})
+	return id
+}
+
+func (t *conversationTree) get(id int) (*turnNode, error) {
+	if id < 0 || id >= len(t.turns) {
+		return nil, fmt.Errorf("turn %d not found", id)
+	}
+	return t.turns[id], nil
+}
+
+// path 返回从根节点到 id 的所有节点
+func (t *conversationTree) path(id int) []*turnNode {
+	path := make([]*turnNode, 0)
+	for id >= 0 {
+		path = append(path, t.turns[id])
+		id = t.turns[id].Parent
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// messages 返回从根节点到 id 路径上的所有消息
+func (t *conversationTree) messages(id int) ([]openai.ChatCompletionMessageParamUnion, []time.Time) {
+	messages := make([]openai.ChatCompletionMessageParamUnion, 0)
+	times := make([]time.Time, 0)
+	for _, turn := range t.path(id) {
+		messages = append(messages, turn.Messages...)
+		times = append(times, turn.Times...)
+	}
+	return messages, times
+}
+
+func (t *conversationTree) childCount(id int) int {
+	count := 0
+	for _, turn := range t.turns {
+		if turn.Parent == id {
+			count++
+		}
+	}
+	return count
+}
+
+// leaves 返回所有叶子节点，每个叶子节点代表一个分支
+func (t *conversationTree) leaves() []int {
+	hasChild := make([]bool, len(t.turns))
+	for _, turn := range t.turns {
+		if turn.Parent >= 0 {
+			hasChild[turn.Parent] = true
+		}
+	}
+	leaves := make([]int, 0)
+	for id := range t.turns {
+		if !hasChild[id] {
+			leaves = append(leaves, id)
+		}
+	}
+	return leaves
+}
+
+// commonAncestor 返回两个节点最近的公共祖先
+func (t *conversationTree) commonAncestor(a, b int) int {
+	ancestors := make(map[int]bool)
+	for _, turn := range t.path(a) {
+		ancestors[turn.ID] = true
+	}
+	for id := b; id >= 0; id = t.turns[id].Parent {
+		if ancestors[id] {
+			return id
+		}
+	}
+	return 0
+}
+
+// TurnInfo 对话树中一轮对话的摘要信息
+type TurnInfo struct {
+	ID       int       `json:"id"`
+	Parent   int       `json:"parent"`
+	Title    string    `json:"title"`    // 本轮的用户输入
+	Messages int       `json:"messages"` // 本轮的消息数
+	Children int       `json:"children"` // 子节点数，大于 1 表示从这里产生了分支
+	Time     time.Time `json:"time"`
+}
+
+// BranchInfo 一个分支，即从根节点到某个叶子节点的路径
+type BranchInfo struct {
+	Head    int       `json:"head"`  // 叶子节点 id
+	Turns   int       `json:"turns"` // 分支上的对话轮数
+	Title   string    `json:"title"` // 最后一轮的用户输入
+	Current bool      `json:"current"`
+	Time    time.Time `json:"time"`
+}
+
+// BranchDiff 两个分支从公共祖先开始各自独有的对话轮次
+type BranchDiff struct {
+	Ancestor int        `json:"ancestor"`
+	From     []TurnInfo `json:"from"`
+	To       []TurnInfo `json:"to"`
+}
+
+func (t *conversationTree) turnInfo(id int) TurnInfo {
+	turn := t.turns[id]
+	info := TurnInfo{
+		ID:       turn.ID,
+		Parent:   turn.Parent,
+		Messages: len(turn.Messages),
+		Children: t.childCount(id),
+	}
+	if len(turn.Times) > 0 {
+		info.Time = turn.Times[len(turn.Times)-1]
+	}
+	if id == 0 {
+		info.Title = "(system prompt)"
+		return info
+	}
+	if len(turn.Messages) > 0 && turn.Messages[0].OfUser != nil {
+		content := turn.Messages[0].OfUser.Content.OfString.Value
+		if strings.HasPrefix(content, compactSummaryPrefix) {
+			info.Title = "(summary of earlier conversation)"
+		} else {
+			info.Title = shortTitle(content, turnTitleRunes)
+		}
+	}
+	return info
+}
+
+func shortTitle(content string, maxRunes int) string {
+	title := []rune(strings.Join(strings.Fields(content), " "))
+	if len(title) > maxRunes {
+		return string(title[:maxRunes]) + "..."
+	}
+	return string(title)
+}
+
+// Snapshot 记录一轮对话开始前的位置，用于取消本轮对话时回退
+type Snapshot struct {
+	head  int
+	turns int
+	todos []tool.TodoItem
+}
+
+func (a *Agent) SessionSnapshot() Snapshot {
+	return Snapshot{head: a.tree.head, turns: len(a.tree.turns), todos: a.todos.Items()}
+}
+
+// RestoreSession 回退到快照的位置，丢弃快照之后新建的轮次（即被取消的这一轮），其他分支不受影响
+func (a *Agent) RestoreSession(snapshot Snapshot) {
+	if snapshot.turns < 1 || snapshot.turns > len(a.tree.turns) {
+		return
+	}
+	a.tree.turns = a.tree.turns[:snapshot.turns]
+	a.tree.head = snapshot.head
+	a.messages, a.messageTimes = a.tree.messages(a.tree.head)
+	a.compactedTokens = 0
+	a.todos.Set(snapshot.todos)
+}
+
+// Turns 返回当前分支上的所有轮次
+func (a *Agent) Turns() []TurnInfo {
+	turns := make([]TurnInfo, 0)
+	for _, turn := range a.tree.path(a.tree.head) {
+		turns = append(turns, a.tree.turnInfo(turn.ID))
+	}
+	return turns
+}
+
+// Branches 返回对话树中的所有分支
+func (a *Agent) Branches() []BranchInfo {
+	branches := make([]BranchInfo, 0)
+	for _, leaf := range a.tree.leaves() {
+		info := a.tree.turnInfo(leaf)
+		branches = append(branches, BranchInfo{
+			Head:    leaf,
+			Turns:   len(a.tree.path(leaf)) - 1,
+			Title:   info.Title,
+			Current: leaf == a.tree.head,
+			Time:    info.Time,
+		})
+	}
+	return branches
+}
+
+// CurrentTurn 当前所在轮次的 id
+func (a *Agent) CurrentTurn() int {
+	return a.tree.head
+}
+
+// Checkout 切换到指定轮次，之后的对话会在该轮次之后继续。切换到较早的轮次再继续对话即产生新的分支
+func (a *Agent) Checkout(id int) error {
+	if _, err := a.tree.get(id); err != nil {
+		return err
+	}
+	a.tree.head = id
+	a.messages, a.messageTimes = a.tree.messages(id)
+	a.compactedTokens = 0
+	return nil
+}
+
+// DiffBranches 比较两个轮次所在分支，返回它们的公共祖先以及各自独有的轮次
+func (a *Agent) DiffBranches(from, to int) (BranchDiff, error) {
+	if _, err := a.tree.get(from); err != nil {
+		return BranchDiff{}, err
+	}
+	if _, err := a.tree.get(to); err != nil {
+		return BranchDiff{}, err
+	}
+
+	ancestor := a.tree.commonAncestor(from, to)
+	diff := BranchDiff{Ancestor: ancestor, From: make([]TurnInfo, 0), To: make([]TurnInfo, 0)}
+	for _, turn := range a.tree.path(from) {
+		if !a.isAncestor(turn.ID, ancestor) {
+			diff.From = append(diff.From, a.tree.turnInfo(turn.ID))
+		}
+	}
+	for _, turn := range a.tree.path(to) {
+		if !a.isAncestor(turn.ID, ancestor) {
+			diff.To = append(diff.To, a.tree.turnInfo(turn.ID))
+		}
+	}
+	return diff, nil
+}
+
+// isAncestor 判断 id 是否在根节点到 of 的路径上
+func (a *Agent) isAncestor(id int, of int) bool {
+	for cur := of; cur >= 0; cur = a.tree.turns[cur].Parent {
+		if cur == id {
+			return true
+		}
+	}
+	return false
+}
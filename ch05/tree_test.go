@@ -0,0 +1,99 @@
+package ch05
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go/v3"
+)
+
+// newTestTree 构造如下的对话树，head 为 4
+//
+//	0 ─ 1 ─ 2 ─ 3
+//	     └─ 4 ─ 5
+//	          └─ 6
+func newTestTree() *conversationTree {
+	now := time.Now()
+	tree := newConversationTree(openai.SystemMessage("system"), now)
+	for _, parent := range []int{0, 1, 2, 1, 4, 4} {
+		tree.addTurn(parent, []openai.ChatCompletionMessageParamUnion{openai.UserMessage("q")}, []time.Time{now})
+	}
+	tree.head = 4
+	return tree
+}
+
+func turnIDs(turns []*turnNode) []int {
+	ids := make([]int, 0, len(turns))
+	for _, turn := range turns {
+		ids = append(ids, turn.ID)
+	}
+	return ids
+}
+
+func TestConversationTree(t *testing.T) {
+	tree := newTestTree()
+
+	if got := turnIDs(tree.path(5)); !slices.Equal(got, []int{0, 1, 4, 5}) {
+		t.Errorf("path(5): got %v", got)
+	}
+	if got := turnIDs(tree.path(0)); !slices.Equal(got, []int{0}) {
+		t.Errorf("path(0): got %v", got)
+	}
+	if messages, times := tree.messages(3); len(messages) != 4 || len(times) != 4 {
+		t.Errorf("messages(3): %d messages, %d times", len(messages), len(times))
+	}
+	if got := tree.leaves(); !slices.Equal(got, []int{3, 5, 6}) {
+		t.Errorf("leaves: got %v", got)
+	}
+	if got := tree.childCount(1); got != 2 {
+		t.Errorf("childCount(1): got %d", got)
+	}
+	for _, tt := range []struct{ a, b, want int }{{3, 5, 1}, {5, 6, 4}, {2, 3, 2}, {0, 6, 0}, {6, 6, 6}} {
+		if got := tree.commonAncestor(tt.a, tt.b); got != tt.want {
+			t.Errorf("commonAncestor(%d, %d): got %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+	if _, err := tree.get(7); err == nil {
+		t.Error("get(7): want an error")
+	}
+	if _, err := tree.get(-1); err == nil {
+		t.Error("get(-1): want an error")
+	}
+}
+
+func TestAgentBranches(t *testing.T) {
+	a := newSessionTestAgent(t, "")
+	a.tree = newTestTree()
+	a.messages, a.messageTimes = a.tree.messages(a.tree.head)
+
+	diff, err := a.DiffBranches(3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, to := make([]int, 0), make([]int, 0)
+	for _, turn := range diff.From {
+		from = append(from, turn.ID)
+	}
+	for _, turn := range diff.To {
+		to = append(to, turn.ID)
+	}
+	if diff.Ancestor != 1 || !slices.Equal(from, []int{2, 3}) || !slices.Equal(to, []int{4, 5}) {
+		t.Errorf("DiffBranches(3, 5): ancestor %d, from %v, to %v", diff.Ancestor, from, to)
+	}
+
+	// 取消的一轮对话被丢弃，回到快照时的位置
+	snapshot := a.SessionSnapshot()
+	addTestTurn(a, "cancelled")
+	a.RestoreSession(snapshot)
+	if len(a.tree.turns) != 7 || a.CurrentTurn() != 4 || len(a.messages) != 3 {
+		t.Errorf("after restore: %d turns, head %d, %d messages", len(a.tree.turns), a.CurrentTurn(), len(a.messages))
+	}
+
+	if err := a.Checkout(9); err == nil {
+		t.Error("Checkout(9): want an error")
+	}
+	if a.CurrentTurn() != 4 {
+		t.Errorf("failed checkout moved the head to %d", a.CurrentTurn())
+	}
+}
@@ -0,0 +1,101 @@
+package ch05
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/openai/openai-go/v3"
+
+	"babyagent/ch05/tokenizer"
+)
+
+// truncatedToolHeadRunes 裁剪 tool 消息时保留的开头字符数
+const truncatedToolHeadRunes = 1024
+
+// turnRange 表示 messages[start:end] 构成的一个对话轮次，从一条 user 消息开始，
+// 包含其后的 assistant 消息以及 tool 消息，因此带 tool_calls 的 assistant 消息不会和它的 tool 消息分离
+type turnRange struct {
+	start int
+	end   int
+}
+
+// truncateMessages 在发送给模型之前，将上下文控制在 budget 个 token 以内，不会修改传入的 messages。
+// 1. system prompt（messages[0]）和当前轮次始终保留
+// 2. 优先按轮次丢弃最早的对话
+// 3. 如果仍然超出预算，从最早的 tool 消息开始裁剪其内容
+func truncateMessages(counter tokenizer.Tokenizer, messages []openai.ChatCompletionMessageParamUnion, budget int) []openai.ChatCompletionMessageParamUnion {
+	if budget <= 0 || len(messages) <= 1 {
+		return messages
+	}
+	total := estimateMessagesTokens(counter, messages)
+	if total <= budget {
+		return messages
+	}
+	before := total
+
+	current := currentTurnStart(messages)
+	keepFrom := 1
+	for _, turn := range splitTurns(messages, 1, current) {
+		if total <= budget {
+			break
+		}
+		total -= estimateMessagesTokens(counter, messages[turn.start:turn.end])
+		keepFrom = turn.end
+	}
+
+	result := make([]openai.ChatCompletionMessageParamUnion, 0, len(messages)-keepFrom+1)
+	result = append(result, messages[0])
+	result = append(result, messages[keepFrom:]...)
+
+	for i := range result {
+		if total <= budget {
+			break
+		}
+		trimmed, ok := trimToolMessage(result[i])
+		if !ok {
+			continue
+		}
+		total += estimateMessageTokens(counter, trimmed) - estimateMessageTokens(counter, result[i])
+		result[i] = trimmed
+	}
+
+	log.Printf("context truncated: %d -> %d tokens (budget %d), dropped %d messages", before, total, budget, keepFrom-1)
+	return result
+}
+
+// currentTurnStart 返回最后一条 user 消息的下标，即当前轮次的起点
+func currentTurnStart(messages []openai.ChatCompletionMessageParamUnion) int {
+	for i := len(messages) - 1; i >= 1; i-- {
+		if messages[i].OfUser != nil {
+			return i
+		}
+	}
+	return len(messages)
+}
+
+// splitTurns 将 messages[start:end] 按 user 消息切分为轮次
+func splitTurns(messages []openai.ChatCompletionMessageParamUnion, start, end int) []turnRange {
+	turns := make([]turnRange, 0)
+	for i := start; i < end; i++ {
+		if i == start || messages[i].OfUser != nil {
+			turns = append(turns, turnRange{start: i, end: i + 1})
+			continue
+		}
+		turns[len(turns)-1].end = i + 1
+	}
+	return turns
+}
+
+// trimToolMessage 只保留 tool 消息开头的部分内容，并注明被裁剪的长度
+func trimToolMessage(message openai.ChatCompletionMessageParamUnion) (openai.ChatCompletionMessageParamUnion, bool) {
+	if message.OfTool == nil {
+		return message, false
+	}
+	content := []rune(message.OfTool.Content.OfString.Value)
+	if len(content) <= truncatedToolHeadRunes {
+		return message, false
+	}
+	trimmed := fmt.Sprintf("%s\n...[truncated %d characters to fit the context budget]",
+		string(content[:truncatedToolHeadRunes]), len(content)-truncatedToolHeadRunes)
+	return openai.ToolMessage(trimmed, message.OfTool.ToolCallID), true
+}
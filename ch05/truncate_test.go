@@ -0,0 +1,148 @@
+package ch05
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go/v3"
+
+	"babyagent/ch05/tokenizer"
+)
+
+// toolCallMessage 带一个工具调用的 assistant 消息
+func toolCallMessage(id string) openai.ChatCompletionMessageParamUnion {
+	return openai.ChatCompletionMessageParamUnion{OfAssistant: &openai.ChatCompletionAssistantMessageParam{
+		ToolCalls: []openai.ChatCompletionMessageToolCallUnionParam{{
+			OfFunction: &openai.ChatCompletionMessageFunctionToolCallParam{
+				ID:       id,
+				Function: openai.ChatCompletionMessageFunctionToolCallFunctionParam{Name: "bash", Arguments: `{"command":"ls"}`},
+			},
+		}},
+	}}
+}
+
+// toolTurn 一轮带工具调用的对话：user、assistant tool call、tool 结果、assistant 回答
+func toolTurn(query string, id string, output string) []openai.ChatCompletionMessageParamUnion {
+	return []openai.ChatCompletionMessageParamUnion{
+		openai.UserMessage(query),
+		toolCallMessage(id),
+		openai.ToolMessage(output, id),
+		openai.AssistantMessage("done " + query),
+	}
+}
+
+// checkMessageSequence 检查消息序列可以直接发送给模型：以 system prompt 开始，每条 tool 消息都紧跟在发起调用的 assistant 消息之后
+func checkMessageSequence(t *testing.T, messages []openai.ChatCompletionMessageParamUnion) {
+	t.Helper()
+	if len(messages) == 0 || messages[0].OfSystem == nil {
+		t.Fatal("the system prompt is missing")
+	}
+	pending := map[string]bool{}
+	for i, message := range messages {
+		switch {
+		case message.OfAssistant != nil:
+			pending = map[string]bool{}
+			for _, toolCall := range message.OfAssistant.ToolCalls {
+				pending[toolCall.OfFunction.ID] = true
+			}
+		case message.OfTool != nil:
+			if !pending[message.OfTool.ToolCallID] {
+				t.Fatalf("message %d: tool result %s without its tool call", i, message.OfTool.ToolCallID)
+			}
+			delete(pending, message.OfTool.ToolCallID)
+		default:
+			if len(pending) > 0 {
+				t.Fatalf("message %d: tool calls %v without results", i, pending)
+			}
+		}
+	}
+}
+
+func userQueries(messages []openai.ChatCompletionMessageParamUnion) []string {
+	queries := make([]string, 0)
+	for _, message := range messages {
+		if message.OfUser != nil {
+			queries = append(queries, message.OfUser.Content.OfString.Value)
+		}
+	}
+	return queries
+}
+
+func TestTruncateMessages(t *testing.T) {
+	counter := tokenizer.Heuristic{}
+	messages := []openai.ChatCompletionMessageParamUnion{openai.SystemMessage("system prompt")}
+	messages = append(messages, toolTurn("first", "call_1", strings.Repeat("old output ", 200))...)
+	messages = append(messages, toolTurn("second", "call_2", strings.Repeat("more output ", 200))...)
+	messages = append(messages, toolTurn("current", "call_3", "small output")...)
+	total := estimateMessagesTokens(counter, messages)
+	current := estimateMessagesTokens(counter, messages[9:])
+	second := estimateMessagesTokens(counter, messages[5:9])
+
+	if got := truncateMessages(counter, messages, total); len(got) != len(messages) {
+		t.Errorf("within the budget: got %d messages, want all %d", len(got), len(messages))
+	}
+	if got := truncateMessages(counter, messages, 0); len(got) != len(messages) {
+		t.Errorf("no budget: got %d messages, want all %d", len(got), len(messages))
+	}
+
+	// 丢弃整个最早的轮次，保留之后的轮次
+	budget := estimateMessagesTokens(counter, messages[:1]) + second + current
+	got := truncateMessages(counter, messages, budget)
+	checkMessageSequence(t, got)
+	if queries := userQueries(got); strings.Join(queries, ",") != "second,current" {
+		t.Errorf("dropping the oldest turn: kept %v", queries)
+	}
+	if tokens := estimateMessagesTokens(counter, got); tokens > budget {
+		t.Errorf("dropping the oldest turn: %d tokens over the budget %d", tokens, budget)
+	}
+
+	// 预算只够当前轮次时丢弃所有较早的轮次
+	got = truncateMessages(counter, messages, current+estimateMessagesTokens(counter, messages[:1]))
+	checkMessageSequence(t, got)
+	if len(got) != 5 || strings.Join(userQueries(got), ",") != "current" {
+		t.Errorf("keeping only the current turn: got %d messages, queries %v", len(got), userQueries(got))
+	}
+
+	if len(messages) != 13 || messages[3].OfTool.Content.OfString.Value != strings.Repeat("old output ", 200) {
+		t.Error("the input messages were modified")
+	}
+}
+
+func TestTruncateMessagesTrimsCurrentTurn(t *testing.T) {
+	counter := tokenizer.Heuristic{}
+	large := strings.Repeat("x", truncatedToolHeadRunes*20)
+	messages := []openai.ChatCompletionMessageParamUnion{openai.SystemMessage("system prompt")}
+	messages = append(messages, toolTurn("old", "call_1", "old output")...)
+	// 当前轮次包含多次工具调用，本身就超出预算
+	messages = append(messages, openai.UserMessage("current"), toolCallMessage("call_2"), openai.ToolMessage(large, "call_2"),
+		toolCallMessage("call_3"), openai.ToolMessage(large, "call_3"))
+
+	budget := estimateMessagesTokens(counter, messages[len(messages)-5:]) / 4
+	got := truncateMessages(counter, messages, budget)
+	checkMessageSequence(t, got)
+	if len(got) != 6 || strings.Join(userQueries(got), ",") != "current" {
+		t.Fatalf("got %d messages, queries %v, want the system prompt and the whole current turn", len(got), userQueries(got))
+	}
+	for _, i := range []int{3, 5} {
+		content := got[i].OfTool.Content.OfString.Value
+		if !strings.HasPrefix(content, large[:truncatedToolHeadRunes]) || !strings.Contains(content, "[truncated 19456 characters to fit the context budget]") {
+			t.Errorf("tool message %d was not trimmed: %d characters", i, len(content))
+		}
+	}
+	if got[3].OfTool.ToolCallID != "call_2" || got[5].OfTool.ToolCallID != "call_3" {
+		t.Error("trimmed tool messages lost their tool call ids")
+	}
+}
+
+func TestSplitTurns(t *testing.T) {
+	messages := []openai.ChatCompletionMessageParamUnion{openai.SystemMessage("system")}
+	messages = append(messages, toolTurn("a", "call_1", "x")...)
+	messages = append(messages, openai.UserMessage("b"), openai.AssistantMessage("y"))
+	turns := splitTurns(messages, 1, len(messages))
+	if len(turns) != 2 || turns[0] != (turnRange{start: 1, end: 5}) || turns[1] != (turnRange{start: 5, end: 7}) {
+		t.Errorf("got %+v", turns)
+	}
+	if got := currentTurnStart(messages); got != 5 {
+		t.Errorf("currentTurnStart: got %d, want 5", got)
+	}
+}
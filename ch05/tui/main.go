@@ -2,11 +2,16 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"charm.land/bubbles/v2/viewport"
 	tea "charm.land/bubbletea/v2"
@@ -40,7 +45,7 @@ type activeStream struct {
 	events <-chan ch05.MessageVO
 	cancel context.CancelFunc
 
-	turnSnapshot int
+	turnSnapshot ch05.Snapshot
 	turnLogLen   int
 	reasonBody   int
 	contentBody  int
@@ -58,6 +63,8 @@ type model struct {
 	active *activeStream
 
 	notice string
+	usage  ch05.SessionUsage
+	todos  []ch05.TodoVO
 
 	width  int
 	height int
@@ -75,8 +82,12 @@ var (
 	footerStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("245"))
 	borderStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
 	contentStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("252"))
+	doneStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("242")).Strikethrough(true)
 )
 
+// todoPanelMaxItems 任务面板最多显示的任务数，超出时优先隐藏已完成的任务
+const todoPanelMaxItems = 8
+
 func newModel(agent *ch05.Agent, modelName string) *model {
 	vp := viewport.New()
 	vp.SoftWrap = true
@@ -201,10 +212,39 @@ func (m *model) handleSubmit() (tea.Model, tea.Cmd) {
 	}
 
 	m.input = ""
+	// 命令名必须完整匹配，例如 /different 不是 /diff 命令
+	command, args, _ := strings.Cut(query, " ")
 	if query == "/clear" {
 		m.clearSession()
 		return m, nil
 	}
+	if query == "/compact" {
+		return m.startCompact()
+	}
+	if query == "/sessions" {
+		m.listSessions()
+		return m, nil
+	}
+	if command == "/resume" {
+		m.resumeSession(strings.TrimSpace(args))
+		return m, nil
+	}
+	if query == "/turns" {
+		m.listTurns()
+		return m, nil
+	}
+	if query == "/branches" {
+		m.listBranches()
+		return m, nil
+	}
+	if command == "/checkout" {
+		m.checkout(strings.TrimSpace(args))
+		return m, nil
+	}
+	if command == "/diff" {
+		m.diffBranches(strings.Fields(args))
+		return m, nil
+	}
 
 	return m.startNewTurn(query)
 }
@@ -230,12 +270,54 @@ func (m *model) handleStreamEvent(event ch05.MessageVO) {
 			m.appendLogBlock("工具调用:", fmt.Sprintf("%s(%s)", event.ToolCall.Name, event.ToolCall.Arguments))
 			m.resetOutputSection()
 		}
+	case ch05.MessageTypeToolDone:
+		if event.ToolCall != nil {
+			status := "完成"
+			if event.ToolCall.IsError {
+				status = "失败"
+			}
+			line := fmt.Sprintf("工具%s: %s（%s）", status, event.ToolCall.Name, event.ToolCall.Duration.Round(time.Millisecond))
+			if metadata := formatMetadata(event.ToolCall.Metadata); metadata != "" {
+				line += " " + metadata
+			}
+			m.logs = append(m.logs, line, "")
+			m.resetOutputSection()
+		}
 	case ch05.MessageTypeError:
 		if event.Content != nil {
 			m.appendLogBlock("错误:", *event.Content)
 			m.resetOutputSection()
 		}
+	case ch05.MessageTypeUsage:
+		if event.Usage != nil {
+			m.usage = event.Usage.Session
+		}
+	case ch05.MessageTypeCompact:
+		if event.Content != nil {
+			m.appendLogBlock("上下文压缩:", *event.Content)
+			m.resetOutputSection()
+		}
+	case ch05.MessageTypeTodo:
+		m.todos = event.Todos
+	}
+}
+
+// formatMetadata 把工具结果的元数据渲染为按键名排序的 key=value 列表
+func formatMetadata(metadata map[string]any) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := metadata[key]
+		if files, ok := value.([]string); ok {
+			value = strings.Join(files, ",")
+		}
+		parts = append(parts, fmt.Sprintf("%s=%v", key, value))
 	}
+	return strings.Join(parts, " ")
 }
 
 func (m *model) appendReasoning(chunk string) {
@@ -291,6 +373,12 @@ func (m *model) handleStreamDone(msg streamDoneMsg) (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
+	if errors.Is(msg.err, ch05.ErrNothingToCompact) {
+		m.notice = "暂无可压缩的历史对话。"
+		m.state = stateIdle
+		return m, nil
+	}
+
 	if msg.err != nil {
 		m.appendLogBlock("错误:", msg.err.Error())
 	}
@@ -308,6 +396,18 @@ func (m *model) startNewTurn(query string) (tea.Model, tea.Cmd) {
 	m.logs = append(m.logs, fmt.Sprintf("第 %d 轮", m.round), "")
 	m.appendLogBlock("你:", query)
 
+	return m.startStream(turnStart, func(ctx context.Context, viewCh chan ch05.MessageVO) error {
+		return m.agent.RunStreaming(ctx, query, viewCh)
+	})
+}
+
+func (m *model) startCompact() (tea.Model, tea.Cmd) {
+	m.notice = ""
+	return m.startStream(len(m.logs), m.agent.Compact)
+}
+
+// startStream 在后台运行 run，并通过 channel 将事件和结果传回 UI
+func (m *model) startStream(turnLogLen int, run func(ctx context.Context, viewCh chan ch05.MessageVO) error) (tea.Model, tea.Cmd) {
 	streamC := make(chan ch05.MessageVO, 256)
 	doneC := make(chan error, 1)
 	ctx, cancel := context.WithCancel(context.Background())
@@ -315,7 +415,7 @@ func (m *model) startNewTurn(query string) (tea.Model, tea.Cmd) {
 		events:       streamC,
 		cancel:       cancel,
 		turnSnapshot: m.agent.SessionSnapshot(),
-		turnLogLen:   turnStart,
+		turnLogLen:   turnLogLen,
 		reasonBody:   -1,
 		contentBody:  -1,
 	}
@@ -323,7 +423,7 @@ func (m *model) startNewTurn(query string) (tea.Model, tea.Cmd) {
 	m.refreshLogsViewportContent()
 
 	go func() {
-		err := m.agent.RunStreaming(ctx, query, streamC)
+		err := run(ctx, streamC)
 		close(streamC)
 		doneC <- err
 		close(doneC)
@@ -333,13 +433,172 @@ func (m *model) startNewTurn(query string) (tea.Model, tea.Cmd) {
 }
 
 func (m *model) clearSession() {
-	m.agent.ResetSession()
+	if err := m.agent.ResetSession(); err != nil {
+		m.notice = fmt.Sprintf("清空会话失败: %v", err)
+		return
+	}
 	m.logs = m.logs[:0]
 	m.notice = "会话已清空（仅保留 system prompt）。"
+	m.usage = m.agent.Usage()
+	m.todos = nil
 	m.round = 0
 	m.refreshLogsViewportContent()
 }
 
+func (m *model) listSessions() {
+	sessions, err := m.agent.ListSessions()
+	if err != nil {
+		m.notice = fmt.Sprintf("读取会话列表失败: %v", err)
+		return
+	}
+	if len(sessions) == 0 {
+		m.notice = "暂无已保存的会话。"
+		return
+	}
+	lines := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		current := ""
+		if session.ID == m.agent.SessionID() {
+			current = " (当前)"
+		}
+		lines = append(lines, fmt.Sprintf("%s  %s  %s  [%d 条消息]%s",
+			session.ID, session.UpdatedAt.Format("2006-01-02 15:04"), session.Title, session.Messages, current))
+	}
+	m.appendLogBlock("会话列表:", strings.Join(lines, "\n"))
+	m.notice = "使用 /resume <id> 恢复会话。"
+	m.refreshLogsViewportContent()
+}
+
+func (m *model) resumeSession(id string) {
+	if id == "" {
+		m.notice = "用法: /resume <id>"
+		return
+	}
+	if err := m.agent.ResumeSession(id); err != nil {
+		m.notice = fmt.Sprintf("恢复会话失败: %v", err)
+		return
+	}
+	m.rebuildLogs()
+	m.notice = fmt.Sprintf("已恢复会话 %s。", m.agent.SessionID())
+}
+
+func (m *model) listTurns() {
+	lines := make([]string, 0)
+	for _, turn := range m.agent.Turns() {
+		fork := ""
+		if turn.Children > 1 {
+			fork = fmt.Sprintf("  (%d 个分支)", turn.Children)
+		}
+		lines = append(lines, fmt.Sprintf("#%d  %s%s", turn.ID, turn.Title, fork))
+	}
+	m.appendLogBlock("对话轮次:", strings.Join(lines, "\n"))
+	m.notice = "使用 /checkout <id> 回到某一轮，之后的输入会产生新的分支。"
+	m.refreshLogsViewportContent()
+}
+
+func (m *model) listBranches() {
+	lines := make([]string, 0)
+	for _, branch := range m.agent.Branches() {
+		current := ""
+		if branch.Current {
+			current = " (当前)"
+		}
+		lines = append(lines, fmt.Sprintf("#%d  %s  %s  [%d 轮]%s",
+			branch.Head, branch.Time.Format("2006-01-02 15:04"), branch.Title, branch.Turns, current))
+	}
+	m.appendLogBlock("分支列表:", strings.Join(lines, "\n"))
+	m.notice = "使用 /checkout <id> 切换分支，/diff <id> 与当前分支比较。"
+	m.refreshLogsViewportContent()
+}
+
+func (m *model) checkout(arg string) {
+	id, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+	if err != nil {
+		m.notice = "用法: /checkout <id>"
+		return
+	}
+	if err := m.agent.Checkout(id); err != nil {
+		m.notice = fmt.Sprintf("切换失败: %v", err)
+		return
+	}
+	if err := m.agent.SaveSession(); err != nil {
+		log.Printf("failed to save session: %v", err)
+	}
+	m.rebuildLogs()
+	m.notice = fmt.Sprintf("已切换到第 #%d 轮。", id)
+}
+
+func (m *model) diffBranches(args []string) {
+	ids := make([]int, 0, 2)
+	for _, arg := range args {
+		id, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+		if err != nil {
+			ids = nil
+			break
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 1 {
+		ids = append([]int{m.agent.CurrentTurn()}, ids...)
+	}
+	if len(ids) != 2 {
+		m.notice = "用法: /diff <id> [id]"
+		return
+	}
+	diff, err := m.agent.DiffBranches(ids[0], ids[1])
+	if err != nil {
+		m.notice = fmt.Sprintf("比较失败: %v", err)
+		return
+	}
+
+	lines := []string{fmt.Sprintf("公共祖先: #%d", diff.Ancestor)}
+	for _, side := range []struct {
+		head  int
+		turns []ch05.TurnInfo
+	}{{ids[0], diff.From}, {ids[1], diff.To}} {
+		lines = append(lines, fmt.Sprintf("#%d 独有的 %d 轮:", side.head, len(side.turns)))
+		for _, turn := range side.turns {
+			lines = append(lines, fmt.Sprintf("  #%d  %s", turn.ID, turn.Title))
+		}
+	}
+	m.appendLogBlock("分支比较:", strings.Join(lines, "\n"))
+	m.refreshLogsViewportContent()
+}
+
+// rebuildLogs 根据 agent 中的历史消息重建界面日志
+func (m *model) rebuildLogs() {
+	m.logs = m.logs[:0]
+	m.round = 0
+	m.usage = m.agent.Usage()
+	m.todos = m.agent.Todos()
+	for _, event := range m.agent.History() {
+		if event.Content == nil && event.ToolCall == nil {
+			continue
+		}
+		switch event.Type {
+		case ch05.MessageTypeUser:
+			if m.round > 0 {
+				m.ensureTrailingBlank()
+				m.logs = append(m.logs, strings.Repeat("─", 48))
+			}
+			m.round++
+			m.logs = append(m.logs, fmt.Sprintf("第 %d 轮", m.round), "")
+			m.appendLogBlock("你:", *event.Content)
+		case ch05.MessageTypeContent:
+			m.appendLogBlock("回答:", *event.Content)
+		case ch05.MessageTypeToolCall:
+			m.appendLogBlock("工具调用:", fmt.Sprintf("%s(%s)", event.ToolCall.Name, event.ToolCall.Arguments))
+		case ch05.MessageTypeCompact:
+			m.appendLogBlock("上下文压缩:", *event.Content)
+		}
+	}
+	if m.round > 0 {
+		m.ensureTrailingBlank()
+		m.logs = append(m.logs, strings.Repeat("─", 48))
+	}
+	m.refreshLogsViewportContent()
+}
+
 func (m *model) abortCurrentTurn() {
 	if m.state != stateRunning || m.active == nil || m.active.cancel == nil {
 		return
@@ -354,6 +613,7 @@ func (m *model) rollbackTurn() {
 		return
 	}
 	m.agent.RestoreSession(m.active.turnSnapshot)
+	m.todos = m.agent.Todos()
 	if m.active.turnLogLen >= 0 && m.active.turnLogLen <= len(m.logs) {
 		m.logs = m.logs[:m.active.turnLogLen]
 	}
@@ -399,14 +659,62 @@ func (m *model) logsHeaderHeight() int {
 }
 
 func (m *model) logsFooterHeight() int {
-	h := 4
+	h := 5
 	if m.state != stateIdle {
 		h++
 	}
 	if m.notice != "" {
 		h++
 	}
-	return h
+	return h + len(m.todoPanelLines())
+}
+
+// todoPanelLines 渲染固定在输入框上方的任务面板，没有任务时为空
+func (m *model) todoPanelLines() []string {
+	if len(m.todos) == 0 {
+		return nil
+	}
+	done := 0
+	for _, todo := range m.todos {
+		if todo.Status == tool.TodoStatusDone {
+			done++
+		}
+	}
+	// 任务过多时隐藏最早完成的任务
+	hidden := make(map[int]bool)
+	for i := 0; i < len(m.todos) && len(m.todos)-len(hidden) > todoPanelMaxItems; i++ {
+		if m.todos[i].Status == tool.TodoStatusDone {
+			hidden[i] = true
+		}
+	}
+
+	lines := []string{labelStyle.Render(fmt.Sprintf("任务 (%d/%d 完成):", done, len(m.todos)))}
+	shown := 0
+	for i, todo := range m.todos {
+		if hidden[i] {
+			continue
+		}
+		if shown == todoPanelMaxItems {
+			lines = append(lines, footerStyle.Render(fmt.Sprintf("  ... 还有 %d 项", len(m.todos)-len(hidden)-shown)))
+			break
+		}
+		shown++
+		switch todo.Status {
+		case tool.TodoStatusDone:
+			lines = append(lines, "  ✓ "+doneStyle.Render(todo.Content))
+		case tool.TodoStatusInProgress:
+			lines = append(lines, toolStyle.Render("  ▶ "+todo.Content))
+		default:
+			lines = append(lines, contentStyle.Render("  ○ "+todo.Content))
+		}
+	}
+	// 每项只占一行，过长时截断，保证面板高度与行数一致
+	if m.width > 0 {
+		for i := range lines {
+			lines[i] = lipgloss.NewStyle().MaxWidth(m.width).Render(lines[i])
+		}
+	}
+	return lines
 }
 
 func (m *model) logsViewportHeight() int {
@@ -452,10 +760,13 @@ func (m *model) renderLogLine(line string) string {
 		return contentStyle.Render(line)
 	case strings.HasPrefix(line, "推理:"):
 		return reasonStyle.Render(line)
-	case strings.HasPrefix(line, "工具调用:"):
+	case strings.HasPrefix(line, "工具调用:"), strings.HasPrefix(line, "工具完成:"):
 		return toolStyle.Render(line)
-	case strings.HasPrefix(line, "错误:"):
+	case strings.HasPrefix(line, "错误:"), strings.HasPrefix(line, "工具失败:"):
 		return errorStyle.Render(line)
+	case strings.HasPrefix(line, "上下文压缩:"), strings.HasPrefix(line, "会话列表:"),
+		strings.HasPrefix(line, "对话轮次:"), strings.HasPrefix(line, "分支列表:"), strings.HasPrefix(line, "分支比较:"):
+		return noticeStyle.Render(line)
 	case strings.Trim(line, "─") == "":
 		return borderStyle.Render(line)
 	default:
@@ -474,12 +785,20 @@ func (m *model) View() tea.View {
 	b.WriteString("\n")
 	b.WriteString(labelStyle.Render("当前模型: "))
 	b.WriteString(contentStyle.Render(m.modelName))
+	if m.usage.Calls > 0 {
+		b.WriteString(footerStyle.Render(fmt.Sprintf("  上下文: %d tokens  累计: %d tokens（%d 次调用）",
+			m.usage.ContextTokens, m.usage.TotalTokens, m.usage.Calls)))
+	}
 	b.WriteString("\n")
 	b.WriteString(contentStyle.Render("欢迎使用，输入问题后回车。"))
 	b.WriteString("\n")
 	b.WriteString(m.logsViewport.View())
 
 	b.WriteString("\n")
+	for _, line := range m.todoPanelLines() {
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
 	if m.state != stateIdle {
 		b.WriteString(footerStyle.Render("模型响应中，输入暂不可用。"))
 		b.WriteString("\n")
@@ -488,7 +807,9 @@ func (m *model) View() tea.View {
 	b.WriteString("\n")
 	b.WriteString(footerStyle.Render("快捷键: Ctrl+C 退出，Esc 取消当前流式"))
 	b.WriteString("\n")
-	b.WriteString(footerStyle.Render("命令: /clear 清空会话"))
+	b.WriteString(footerStyle.Render("命令: /clear 清空会话，/compact 压缩上下文，/sessions 会话列表，/resume <id> 恢复会话"))
+	b.WriteString("\n")
+	b.WriteString(footerStyle.Render("分支: /turns 当前分支的轮次，/branches 分支列表，/checkout <id> 切换，/diff <id> [id] 比较"))
 	if m.notice != "" {
 		b.WriteString("\n")
 		b.WriteString(noticeStyle.Render(m.notice))
@@ -500,9 +821,37 @@ func (m *model) View() tea.View {
 	return v
 }
 
+// splitList 拆分逗号分隔的参数，忽略空项
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func main() {
 	_ = godotenv.Load()
 
+	resume := flag.String("resume", "", "resume a saved session by id, or latest for the most recent one")
+	fetchHosts := flag.String("fetch-hosts", "", "comma separated hosts the fetch tool may access, *.example.com matches subdomains, empty allows any host")
+	workspace := flag.String("workspace", "", "workspace root the file tools are confined to, the agent runs in this directory, defaults to the current directory")
+	readRoots := flag.String("read-roots", "", "comma separated extra directories the file tools may read")
+	writeRoots := flag.String("write-roots", "", "comma separated extra directories the file tools may read and modify")
+	flag.Parse()
+
+	if *workspace != "" {
+		if err := os.Chdir(*workspace); err != nil {
+			log.Fatalf("Failed to enter workspace %s: %v", *workspace, err)
+		}
+	}
+	paths, err := shared.NewPathPolicy("", splitList(*readRoots), splitList(*writeRoots))
+	if err != nil {
+		log.Fatalf("Failed to create path policy: %v", err)
+	}
+
 	ctx := context.Background()
 	modelConf := shared.NewModelConfig()
 
@@ -520,16 +869,37 @@ func main() {
 		mcpClients = append(mcpClients, mcpClient)
 	}
 
-	agent := ch05.NewAgent(
+	fetchPolicy := tool.DefaultFetchPolicy
+	fetchPolicy.AllowedHosts = splitList(*fetchHosts)
+
+	agent, err := ch05.NewAgent(
 		modelConf,
+		ch05.NewContextConfig(),
+		paths,
 		ch05.CodingAgentSystemPrompt,
-		[]tool.Tool{tool.NewBashTool()},
+		[]tool.Tool{
+			tool.NewBashTool(paths), tool.NewShellTool(paths), tool.NewGlobTool(paths), tool.NewGrepTool(paths),
+			tool.NewApplyPatchTool(paths), tool.NewFetchTool(nil, fetchPolicy),
+		},
 		mcpClients,
 	)
+	if err != nil {
+		log.Fatalf("Failed to create agent: %v", err)
+	}
+
+	m := newModel(agent, modelConf.Model)
+	if *resume != "" {
+		if err := agent.ResumeSession(*resume); err != nil {
+			log.Fatalf("Failed to resume session %s: %v", *resume, err)
+		}
+		m.rebuildLogs()
+	}
 
 	log.SetOutput(io.Discard)
-	p := tea.NewProgram(newModel(agent, modelConf.Model))
-	if _, err := p.Run(); err != nil {
+	p := tea.NewProgram(m)
+	_, err = p.Run()
+	_ = agent.Close()
+	if err != nil {
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,66 @@
+package ch05
+
+import "github.com/openai/openai-go/v3"
+
+// Usage 模型调用的 token 用量
+type Usage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+	CachedTokens     int64 `json:"cached_tokens"`
+	ReasoningTokens  int64 `json:"reasoning_tokens"`
+}
+
+func newUsage(usage openai.CompletionUsage) Usage {
+	return Usage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+		CachedTokens:     usage.PromptTokensDetails.CachedTokens,
+		ReasoningTokens:  usage.CompletionTokensDetails.ReasoningTokens,
+	}
+}
+
+func (u *Usage) add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+	u.CachedTokens += other.CachedTokens
+	u.ReasoningTokens += other.ReasoningTokens
+}
+
+// SessionUsage 当前会话累计的 token 用量
+type SessionUsage struct {
+	Usage
+	// Calls 模型调用次数
+	Calls int `json:"calls"`
+	// ContextTokens 最近一次对话请求的 prompt token 数，即模型实际看到的上下文大小
+	ContextTokens int64 `json:"context_tokens"`
+}
+
+// Usage 返回当前会话累计的 token 用量
+func (a *Agent) Usage() SessionUsage {
+	return a.usage
+}
+
+// recordUsage 累计一次模型调用的用量，并推送给 UI。isContext 表示这是一次对话请求（而不是摘要等辅助请求）
+func (a *Agent) recordUsage(completionUsage openai.CompletionUsage, isContext bool, viewCh chan MessageVO) {
+	// 部分供应商不返回用量
+	if completionUsage.TotalTokens == 0 {
+		return
+	}
+	usage := newUsage(completionUsage)
+	a.usage.add(usage)
+	a.usage.Calls++
+	if isContext {
+		a.usage.ContextTokens = usage.PromptTokens
+	}
+
+	viewCh <- MessageVO{
+		Type: MessageTypeUsage,
+		Usage: &UsageVO{
+			Call:    usage,
+			Session: a.usage,
+		},
+	}
+}
@@ -1,10 +1,17 @@
 package ch05
 
+import "time"
+
 const (
 	MessageTypeReasoning = "reasoning"
 	MessageTypeContent   = "content"
-	MessageTypeToolCall  = "tool_call"
+	MessageTypeToolCall  = "tool_call" // 工具调用开始
+	MessageTypeToolDone  = "tool_done" // 工具调用结束
 	MessageTypeError     = "error"
+	MessageTypeCompact   = "compact"
+	MessageTypeUsage     = "usage"
+	MessageTypeTodo      = "todo" // 任务列表更新后的完整列表
+	MessageTypeUser      = "user" // 仅用于恢复会话时重建历史
 )
 
 // MessageVO 用于流式展示当前模型流式输出或者状态
@@ -15,9 +22,29 @@ type MessageVO struct {
 	Content          *string `json:"content,omitempty"`
 
 	ToolCall *ToolCallVO `json:"tool,omitempty"`
+
+	Usage *UsageVO `json:"usage,omitempty"`
+
+	Todos []TodoVO `json:"todos,omitempty"`
 }
 
 type ToolCallVO struct {
+	ID        string `json:"id,omitempty"`
 	Name      string `json:"name"`
 	Arguments string `json:"arguments"`
+
+	// 以下字段只在 tool_done 中设置
+	Duration time.Duration  `json:"duration,omitempty"`
+	IsError  bool           `json:"is_error,omitempty"`
+	Metadata map[string]any `json:"metadata,omitempty"` // 工具结果的元数据，例如退出码、修改的文件
+}
+
+type TodoVO struct {
+	Content string `json:"content"`
+	Status  string `json:"status"` // pending、in_progress 或 done
+}
+
+type UsageVO struct {
+	Call    Usage        `json:"call"`    // 本次模型调用的用量
+	Session SessionUsage `json:"session"` // 会话累计用量
 }
@@ -0,0 +1,192 @@
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// maxSymlinkHops 解析路径时最多跟随的符号链接次数，超出时认为存在循环
+const maxSymlinkHops = 255
+
+// PathAccess 工具对路径的访问方式
+type PathAccess int
+
+const (
+	PathRead PathAccess = iota
+	PathWrite
+)
+
+// PathPolicy 限制文件工具可以访问的路径。工作区根目录可读写，另外可以配置只读和可读写的额外目录。
+// 所有路径在检查前都会跟随符号链接解析为真实路径，工作区内指向外部的链接同样会被拒绝
+type PathPolicy struct {
+	root       string
+	readRoots  []string
+	writeRoots []string
+}
+
+// NewPathPolicy 创建路径策略，root 为空时使用当前目录。所有目录必须存在
+func NewPathPolicy(root string, readOnlyRoots []string, readWriteRoots []string) (*PathPolicy, error) {
+	if root == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		root = cwd
+	}
+	resolvedRoot, err := resolveRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	p := &PathPolicy{root: resolvedRoot, writeRoots: []string{resolvedRoot}}
+	for _, dir := range readWriteRoots {
+		resolved, err := resolveRoot(dir)
+		if err != nil {
+			return nil, err
+		}
+		p.writeRoots = append(p.writeRoots, resolved)
+	}
+	for _, dir := range readOnlyRoots {
+		resolved, err := resolveRoot(dir)
+		if err != nil {
+			return nil, err
+		}
+		p.readRoots = append(p.readRoots, resolved)
+	}
+	return p, nil
+}
+
+func resolveRoot(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", fmt.Errorf("workspace root %s: %w", dir, err)
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("workspace root %s is not a directory", dir)
+	}
+	return resolved, nil
+}
+
+// Root 工作区根目录，p 为 nil 时返回空字符串
+func (p *PathPolicy) Root() string {
+	if p == nil {
+		return ""
+	}
+	return p.root
+}
+
+// Resolve 把路径解析为跟随符号链接后的绝对路径，并检查是否允许以 access 方式访问。
+// 相对路径相对于工作区根目录，路径末尾不存在的部分（例如要创建的文件）按字面拼接。
+// p 为 nil 时不做限制，只返回绝对路径
+func (p *PathPolicy) Resolve(path string, access PathAccess) (string, error) {
+	if p == nil {
+		return filepath.Abs(path)
+	}
+	if path == "" {
+		return "", errors.New("path must not be empty")
+	}
+	abs := path
+	if !filepath.IsAbs(abs) {
+		// 不能用 filepath.Join，它会先按字面处理 ..，跳过路径中的符号链接
+		abs = p.root + string(filepath.Separator) + abs
+	}
+	resolved, err := resolveSymlinks(abs)
+	if err != nil {
+		return "", err
+	}
+
+	for _, root := range p.writeRoots {
+		if withinRoot(root, resolved) {
+			return resolved, nil
+		}
+	}
+	for _, root := range p.readRoots {
+		if withinRoot(root, resolved) {
+			if access == PathWrite {
+				return "", fmt.Errorf("%s is in the read-only directory %s and can not be modified", path, root)
+			}
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("%s is outside the allowed directories (%s)", path, strings.Join(p.allowedRoots(), ", "))
+}
+
+// allowedRoots 用于错误信息的目录列表
+func (p *PathPolicy) allowedRoots() []string {
+	roots := make([]string, 0, len(p.writeRoots)+len(p.readRoots))
+	roots = append(roots, p.writeRoots...)
+	for _, root := range p.readRoots {
+		roots = append(roots, root+" (read-only)")
+	}
+	return roots
+}
+
+// resolveSymlinks 逐级解析绝对路径中的符号链接。和 filepath.EvalSymlinks 不同，路径不存在的部分按字面保留，
+// 并且 .. 作用于链接解析后的目录，与操作系统的行为一致
+func resolveSymlinks(path string) (string, error) {
+	volume := filepath.VolumeName(path)
+	pending := strings.Split(filepath.ToSlash(path[len(volume):]), "/")
+	resolved := volume + string(filepath.Separator)
+	hops := 0
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+		next := filepath.Join(resolved, name)
+		info, err := os.Lstat(next)
+		switch {
+		case errors.Is(err, fs.ErrNotExist), errors.Is(err, syscall.ENOTDIR):
+			// 不存在的部分按字面拼接。之后的 .. 可能回到存在的目录，所以每一级都要检查
+			resolved = next
+			continue
+		case err != nil:
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		hops++
+		if hops > maxSymlinkHops {
+			return "", fmt.Errorf("%s: too many levels of symbolic links", path)
+		}
+		target, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			volume = filepath.VolumeName(target)
+			resolved = volume + string(filepath.Separator)
+			target = target[len(volume):]
+		}
+		pending = append(strings.Split(filepath.ToSlash(target), "/"), pending...)
+	}
+	return resolved, nil
+}
+
+func withinRoot(root string, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
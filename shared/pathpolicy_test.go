@@ -0,0 +1,146 @@
+package shared
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestPathPolicyResolve(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symbolic links needs extra privileges on windows")
+	}
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws := filepath.Join(base, "ws")
+	for _, dir := range []string{"ws/src", "ws2", "outside", "ro/docs", "rw", "real"} {
+		if err := os.MkdirAll(filepath.Join(base, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"ws/src/main.go", "ws2/secret", "outside/secret", "ro/docs/a.md"} {
+		if err := os.WriteFile(filepath.Join(base, file), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"ws/escape":      filepath.Join(base, "outside"),
+		"ws/relescape":   "../outside/secret",
+		"ws/inside":      "src",
+		"ws/loop":        "loop",
+		"linked":         filepath.Join(base, "real"),
+		"ws/src/up":      "..",
+		"ws/readonly":    filepath.Join(base, "ro"),
+		"ws/dangling":    filepath.Join(base, "outside", "new.txt"),
+		"ws/danglingdir": filepath.Join(base, "outside", "newdir"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(base, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := NewPathPolicy(ws, []string{filepath.Join(base, "ro")}, []string{filepath.Join(base, "rw")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		access PathAccess
+		want   string // 为空表示应当拒绝
+	}{
+		{name: "relative path", path: "src/main.go", want: filepath.Join(ws, "src/main.go")},
+		{name: "root itself", path: ".", access: PathWrite, want: ws},
+		{name: "absolute path inside", path: filepath.Join(ws, "src"), want: filepath.Join(ws, "src")},
+		{name: "dot dot escape", path: "../outside/secret"},
+		{name: "dot dot escape through a subdirectory", path: "src/../../outside/secret"},
+		{name: "dot dot staying inside", path: "src/../src/main.go", want: filepath.Join(ws, "src/main.go")},
+		{name: "absolute path outside", path: filepath.Join(base, "outside/secret")},
+		{name: "system file", path: "/etc/passwd"},
+		{name: "prefix sibling directory", path: filepath.Join(base, "ws2/secret")},
+		{name: "prefix sibling through dot dot", path: "../ws2/secret"},
+		{name: "symlink to outside", path: "escape/secret"},
+		{name: "relative symlink to outside", path: "relescape"},
+		{name: "symlink inside the root", path: "inside/main.go", want: filepath.Join(ws, "src/main.go")},
+		{name: "dot dot after a symlink applies to its target", path: "src/up/src/main.go", want: filepath.Join(ws, "src/main.go")},
+		{name: "symlink loop", path: "loop"},
+		{name: "new file inside", path: "src/new/file.go", access: PathWrite, want: filepath.Join(ws, "src/new/file.go")},
+		{name: "new file outside", path: "../outside/new.txt", access: PathWrite},
+		{name: "dangling symlink to outside", path: "dangling", access: PathWrite},
+		{name: "new file under a dangling symlink", path: "danglingdir/file", access: PathWrite},
+		{name: "new path with dot dot back outside", path: "missing/../../outside/secret"},
+		{name: "read-only root can be read", path: filepath.Join(base, "ro/docs/a.md"), want: filepath.Join(base, "ro/docs/a.md")},
+		{name: "read-only root can not be written", path: filepath.Join(base, "ro/docs/a.md"), access: PathWrite},
+		{name: "symlink into the read-only root", path: "readonly/docs/a.md", want: filepath.Join(base, "ro/docs/a.md")},
+		{name: "symlink into the read-only root can not be written", path: "readonly/docs/new.md", access: PathWrite},
+		{name: "read-write root can be written", path: filepath.Join(base, "rw/out.txt"), access: PathWrite, want: filepath.Join(base, "rw/out.txt")},
+		{name: "empty path", path: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.Resolve(tt.path, tt.access)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("Resolve(%q) = %q, want an error", tt.path, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve(%q): %v", tt.path, err)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+
+	// 工作区根目录本身是符号链接时，按真实路径检查
+	linked, err := NewPathPolicy(filepath.Join(base, "linked"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linked.Root() != filepath.Join(base, "real") {
+		t.Errorf("root: got %q, want %q", linked.Root(), filepath.Join(base, "real"))
+	}
+	for _, path := range []string{filepath.Join(base, "linked", "file"), filepath.Join(base, "real", "file"), "file"} {
+		if _, err := linked.Resolve(path, PathWrite); err != nil {
+			t.Errorf("symlinked root: Resolve(%q): %v", path, err)
+		}
+	}
+	if _, err := linked.Resolve(filepath.Join(base, "linked", "..", "ws", "src"), PathRead); err == nil {
+		t.Error("symlinked root: .. after the root link escaped to the workspace")
+	}
+}
+
+func TestNewPathPolicyRejectsMissingRoots(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, roots := range [][]string{{filepath.Join(dir, "missing")}, {file}} {
+		if _, err := NewPathPolicy(dir, roots, nil); err == nil {
+			t.Errorf("read-only root %q: want an error", roots[0])
+		}
+		if _, err := NewPathPolicy(dir, nil, roots); err == nil {
+			t.Errorf("read-write root %q: want an error", roots[0])
+		}
+	}
+	if _, err := NewPathPolicy(file, nil, nil); err == nil {
+		t.Error("file as the workspace root: want an error")
+	}
+}
+
+func TestNilPathPolicy(t *testing.T) {
+	var p *PathPolicy
+	want, _ := filepath.Abs("../outside")
+	got, err := p.Resolve("../outside", PathWrite)
+	if err != nil || got != want {
+		t.Errorf("nil policy: got %q, %v, want %q", got, err, want)
+	}
+}